@@ -3,82 +3,291 @@
 package app
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos/iavl"
+	"github.com/davebryson/menta/services/accounts"
+	"github.com/davebryson/menta/services/validators"
 	"github.com/davebryson/menta/storage"
 	sdk "github.com/davebryson/menta/types"
 	abci "github.com/tendermint/tendermint/abci/types"
 	cfg "github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/node"
+	tmcrypto "github.com/tendermint/tendermint/proto/tendermint/crypto"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 var _ abci.Application = (*MentaApp)(nil)
 
+// storeQueryPath is the query path for raw store queries. It can't be used as a service name
+const storeQueryPath = "store"
+
+// state key for the block max gas consensus param
+var maxBlockGasKey = []byte("/menta/params/block_max_gas")
+
+// state key for the chain-id from genesis
+var chainIDKey = []byte("/menta/params/chain_id")
+
+// BlockSource loads a block by height. Tendermint's block store saves a
+// block before it's executed, so menta can verify the signatures of all its
+// txs at once in BeginBlock
+type BlockSource interface {
+	LoadBlock(height int64) *tmtypes.Block
+}
+
 // MentaApp contains all the basics needed to build a tendermint application
 type MentaApp struct {
-	name   string
-	store  *storage.Store
-	cache  *storage.KVCache
-	Config *cfg.Config
-	router map[string]sdk.Service
+	name  string
+	store *storage.Store
+	// cache for DeliverTx. Committed to the store on Commit
+	cache *storage.KVCache
+	// checkCache is used by CheckTx. Discarded and reset on Commit
+	checkCache *storage.KVCache
+	snapshots  *storage.SnapshotManager
+	Config     *cfg.Config
+	router     map[string]sdk.Service
+	// services in the order they were registered
+	services []sdk.Service
+	// gas charged for store access by services
+	gasConfig sdk.GasConfig
+	// gas used by the current block
+	blockGas sdk.GasMeter
+	// from the consensus params. <= 0 is unlimited
+	maxBlockGas int64
+	// wraps the service for every tx
+	middleware []sdk.Middleware
+	// txs with a verified signature
+	verified *sigCache
+	// of the current block, or the last one in CheckTx. On startup it
+	// only has the chain-id and last height
+	header tmproto.Header
+	// where the txs of a block are loaded from to batch verify them
+	blocks  BlockSource
+	logger  log.Logger
+	genesis node.GenesisDocProvider
 }
 
 // NewApp returns a new instance of MentaApp where appname is the name of
-// your application, and homedir is the path where menta/tendermint will
-// store all the data and configuration information
-func NewApp(appname, homedir string) *MentaApp {
-	config, err := LoadConfig(homedir)
-	if err != nil {
-		panic(err)
+// your application. Use WithHomeDir to set the path where menta/tendermint
+// will store all the data and configuration information
+func NewApp(appname string, opts ...Option) (*MentaApp, error) {
+	o := options{logger: logger}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Settings from the config file, unless overridden by an option
+	var config *cfg.Config
+	mc := DefaultMentaConfig()
+	if o.homedir != "" {
+		var err error
+		if config, err = LoadConfig(o.homedir); err != nil {
+			return nil, err
+		}
+		if mc, err = LoadMentaConfig(); err != nil {
+			return nil, err
+		}
+	}
+	if o.backend != "" {
+		mc.DBBackend = o.backend
+	}
+	if o.pruning != nil {
+		mc.Pruning = *o.pruning
+	}
+	if o.snapshotInterval != nil {
+		mc.SnapshotInterval = *o.snapshotInterval
+	}
+	sigCacheSize := DefaultSigCacheSize
+	if o.sigCacheSize != nil {
+		sigCacheSize = *o.sigCacheSize
+	}
+	if sigCacheSize < 0 {
+		return nil, fmt.Errorf("sig cache size can't be negative")
+	}
+
+	store := o.store
+	if store == nil {
+		dbdir := ""
+		if config != nil {
+			dbdir = config.DBDir()
+		}
+		var err error
+		store, err = storage.NewStoreWithOptions(dbdir, storage.Options{
+			Pruning: mc.Pruning,
+			Backend: mc.DBBackend,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	app := &MentaApp{
+		name:       appname,
+		store:      store,
+		cache:      storage.NewCache(store.Snapshot()),
+		checkCache: storage.NewCache(store.Snapshot()),
+		Config:     config,
+		router:     make(map[string]sdk.Service, 0),
+		gasConfig:  sdk.DefaultGasConfig(),
+		blockGas:   sdk.NewInfiniteGasMeter(),
+		verified:   newSigCache(sigCacheSize),
+		blocks:     o.blocks,
+		logger:     o.logger,
+		genesis:    o.genesis,
 	}
+	app.middleware = append([]sdk.Middleware{signatureMiddleware(app.verified), NonceMiddleware}, o.middleware...)
+	app.maxBlockGas = loadMaxBlockGas(app.cache)
+	app.header = tmproto.Header{ChainID: loadChainID(app.cache), Height: store.CommitInfo.Version}
+	app.AddService(accounts.Service{})
+	app.AddService(validators.Service{})
 
-	store := storage.NewStore(config.DBDir())
-	return &MentaApp{
-		name:   appname,
-		store:  store,
-		Config: config,
-		cache:  storage.NewCache(store.Snapshot()),
-		router: make(map[string]sdk.Service, 0),
+	// Snapshots are stored in the home dir. The manager is needed to restore
+	// from state sync even if this node doesn't take snapshots
+	if mc.SnapshotInterval > 0 && config == nil {
+		return nil, fmt.Errorf("state sync snapshots need a home dir")
 	}
+	if config != nil {
+		app.snapshots = storage.NewSnapshotManager(
+			store,
+			filepath.Join(config.DBDir(), "snapshots"),
+			mc.SnapshotInterval,
+			mc.SnapshotKeepRecent,
+		)
+	}
+	return app, nil
 }
 
 // NewMockApp creates a menta app that can be used for local testing
 // without a full blown node and an in memory state tree
-func NewMockApp() *MentaApp {
-	// Returns a inmemory app without tendermint for testing
-	store := storage.NewStore("")
-	return &MentaApp{
-		name:   "mockapp",
-		store:  store,
-		cache:  storage.NewCache(store.Snapshot()),
-		router: make(map[string]sdk.Service, 0),
+func NewMockApp(opts ...Option) *MentaApp {
+	app, err := NewApp("mockapp", opts...)
+	if err != nil {
+		panic(err)
 	}
+	return app
 }
 
-// AddService : registers your service with Menta
+// AddService : registers your service with Menta. The name 'store' is
+// reserved for raw store queries. It panics if the name is empty, has a '/'
+// (queries are routed on it), or starts with the name of another service or
+// vice versa, as the service's keys would overlap in the state tree
 func (app *MentaApp) AddService(service sdk.Service) {
+	if err := validateServiceName(service.Name(), app.services); err != nil {
+		panic(err)
+	}
 	_, exists := app.router[service.Name()]
-	if !exists {
+	if !exists && service.Name() != storeQueryPath {
 		// First come, first serve
 		app.router[service.Name()] = service
+		app.services = append(app.services, service)
 	}
 }
 
+// SetGasConfig sets the gas charged to services for store access.
+// All nodes must use the same config
+func (app *MentaApp) SetGasConfig(config sdk.GasConfig) {
+	app.gasConfig = config
+}
+
 // internal logic for check/deliverTx
-func (app *MentaApp) runTx(rawtx []byte, isCheck bool) sdk.Result {
+func (app *MentaApp) runTx(rawtx []byte, isCheck bool) (result sdk.Result, gas sdk.GasInfo) {
 	tx, err := sdk.DecodeTx(rawtx)
 	if err != nil {
-		return sdk.ErrorBadTx()
+		return sdk.ErrorBadTx(), gas
 	}
+	// Txs from clients that don't set a gas limit get the default
+	gasLimit := tx.GasLimit
+	if gasLimit == 0 {
+		gasLimit = sdk.DefaultGasLimit
+	}
+	gas.GasWanted = gasLimit
 
-	_, ok := app.router[tx.Service]
+	service, ok := app.router[tx.Service]
 	if !ok {
-		return sdk.ResultError(1, "No service found!")
+		return sdk.ResultFromError(sdk.ErrHandlerNotFound.Wrapf("no service '%v'", tx.Service)), gas
+	}
+
+	if app.maxBlockGas > 0 && gasLimit > uint64(app.maxBlockGas) {
+		return sdk.ResultError(sdk.OutOfGas, "gas limit is more than the block max gas"), gas
+	}
+	if !isCheck && gasLimit > app.blockGas.Limit()-app.blockGas.GasConsumed() {
+		return sdk.ResultError(sdk.OutOfGas, "not enough gas left in the block"), gas
 	}
 
+	// Services are charged for store access. Running out of gas panics
+	meter := sdk.NewGasMeter(gasLimit)
+	ctx := sdk.NewContext().
+		WithBlockHeader(app.header).
+		WithGasMeter(meter).
+		WithTxHash(tmhash.Sum(rawtx))
+
+	// Middleware writes to the state directly so the nonce is used even if
+	// the tx fails. The service runs on a branch of the store passed to the
+	// end of the chain, which middleware can wrap
+	var state sdk.Cache = app.cache
 	if isCheck {
-		return validateForCheckTx(tx)
+		state = app.checkCache
 	}
+	final := func(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool) sdk.Result {
+		return app.runService(ctx, service, tx, store, isCheck)
+	}
+
+	defer func() {
+		gas.GasUsed = meter.GasConsumed()
+		if gas.GasUsed > gasLimit {
+			gas.GasUsed = gasLimit
+		}
+		if r := recover(); r != nil {
+			if outOfGas, ok := r.(sdk.ErrorOutOfGas); ok {
+				result = sdk.ResultError(sdk.OutOfGas, fmt.Sprintf("%v, gas limit %v", outOfGas.Error(), gasLimit))
+			} else {
+				// The log must be the same on every node so the panic value
+				// and stack are only in the node's log
+				app.logPanic(r, "tx", hex.EncodeToString(ctx.TxHash()), "service", tx.Service)
+				result = sdk.ResultError(sdk.Panic, fmt.Sprintf("panic in service '%v'", tx.Service))
+			}
+		}
+		// Events emitted by the service are only kept if the tx succeeds
+		result.Events = []abci.Event{txEvent(tx)}
+		if result.Code == sdk.OK {
+			result.Events = append(result.Events, ctx.EventManager().Events()...)
+		}
+	}()
 
-	service := app.router[tx.Service]
-	return service.Execute(tx.Sender, tx.Msgid, tx.Msg, app.cache)
+	result = sdk.ChainMiddleware(final, app.middleware...)(ctx, tx, state, isCheck)
+	return result, gas
+}
+
+// runService runs the tx with its service on a branch of the store, which
+// is only written if the service succeeds. In CheckTx that's the optional
+// Validator check. Running out of gas panics before the branch is written
+func (app *MentaApp) runService(ctx sdk.Context, service sdk.Service, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool) sdk.Result {
+	branch := storage.NewBranch(store)
+	metered := sdk.NewGasCache(branch, ctx.GasMeter(), app.gasConfig)
+	result := sdk.Result{}
+	if isCheck {
+		if validator, ok := service.(sdk.Validator); ok {
+			result = validator.Check(ctx, tx.Sender, tx.Msgid, tx.Msg, metered)
+		}
+	} else {
+		result = execute(ctx, service, tx, metered)
+	}
+	if result.Code == sdk.OK {
+		branch.Write()
+	}
+	return result
 }
 
 // ---------------------------------------------------------------
@@ -88,11 +297,63 @@ func (app *MentaApp) runTx(rawtx []byte, isCheck bool) sdk.Result {
 // ---------------------------------------------------------------
 
 // InitChain is ran once, on the very first run of the application chain.
+// The genesis app state is a JSON object with a section for each service,
+// keyed by the service name. A genesis from ExportGenesis also has the
+// state tree in the 'store' section, which is imported instead so the app
+// hash is the exported chain's. Bad app state, or an error from a service,
+// panics which stops the node
 func (app *MentaApp) InitChain(req abci.RequestInitChain) (resp abci.ResponseInitChain) {
-	data := req.GetAppStateBytes()
-	for _, serv := range app.router {
-		// call initialize on each service
-		serv.Initialize(data, app.cache)
+	app.header = tmproto.Header{ChainID: req.ChainId, Height: req.InitialHeight, Time: req.Time}
+	sections, err := genesisSections(req.AppStateBytes)
+	if err != nil {
+		panic(err)
+	}
+
+	// The store version must match the block height, for chains restarted
+	// from an exported genesis
+	state, imported := sections[genesisStoreSection]
+	delete(sections, genesisStoreSection)
+	if imported {
+		if err := app.importState(req.InitialHeight, state); err != nil {
+			panic(fmt.Errorf("genesis: import state: %w", err))
+		}
+		resp.AppHash = app.store.CommitInfo.Hash
+	} else if req.InitialHeight > 1 {
+		if err := app.store.SetInitialVersion(req.InitialHeight); err != nil {
+			panic(err)
+		}
+	}
+	saveChainID(app.cache, req.ChainId)
+
+	ctx := sdk.NewContext().WithBlockHeader(app.header)
+	for _, serv := range app.services {
+		// Imported state already has the services' state
+		if !imported {
+			if err := serv.Initialize(ctx, sections[serv.Name()], app.cache); err != nil {
+				panic(fmt.Errorf("genesis: service '%v': %w", serv.Name(), err))
+			}
+		}
+		delete(sections, serv.Name())
+	}
+	if len(sections) > 0 {
+		unknown := make([]string, 0, len(sections))
+		for name := range sections {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		panic(fmt.Errorf("genesis: app state has sections for unknown services: %v", strings.Join(unknown, ", ")))
+	}
+
+	// Track the genesis validators so they can be updated later, or use the
+	// ones from the app state
+	resp.Validators, err = validators.InitValidators(app.cache, req.Validators)
+	if err != nil {
+		panic(err)
+	}
+	// Only sent on InitChain, so keep it in state for restarts
+	if req.ConsensusParams != nil && req.ConsensusParams.Block != nil {
+		app.maxBlockGas = req.ConsensusParams.Block.MaxGas
+		saveMaxBlockGas(app.cache, app.maxBlockGas)
 	}
 	return
 }
@@ -110,68 +371,181 @@ func (app *MentaApp) Info(req abci.RequestInfo) abci.ResponseInfo {
 	}
 }
 
-// Query *committed* state in the Tree
-// This calls the handler where the path is the Service name return from
-// Service.Route() and the key is the application specific key in storage
+// Query *committed* state in the Tree. Paths are:
+//
+//	/<service>            calls Service.Query with the key in query.Data
+//	/<service>/<endpoint> calls the endpoint registered with the service's Router
+//	/store/key            returns the raw value in the tree, with a proof if query.Prove is set
+//
+// query.Height selects a retained version of state. 0 is the latest
 func (app *MentaApp) Query(query abci.RequestQuery) abci.ResponseQuery {
 	res := abci.ResponseQuery{}
-	if query.Data == nil || len(query.Data) == 0 {
+	snapshot, err := app.store.SnapshotAt(query.Height)
+	if err != nil {
 		res.Code = sdk.BadQuery
-		res.Log = "Error: query requires a key"
+		res.Codespace = sdk.RootCodespace
+		res.Log = fmt.Sprintf("height %v: %v", query.Height, err)
 		return res
 	}
-	queryKey := query.Data
-	serviceName := query.Path
+	res.Height = query.Height
+	if res.Height == 0 {
+		res.Height = app.store.CommitInfo.Version
+	}
+
+	serviceName, endpoint := splitQueryPath(query.Path)
+	if serviceName == storeQueryPath {
+		return queryStore(res, query, endpoint, snapshot)
+	}
 
-	// Note: query
 	service, ok := app.router[serviceName]
 	if !ok {
 		res.Code = sdk.BadQuery
+		res.Codespace = sdk.RootCodespace
 		res.Log = "no query handler found"
 		return res
 	}
 
-	result := service.Query(queryKey, app.store.Snapshot())
+	ctx := sdk.NewContext().WithBlockHeader(tmproto.Header{ChainID: app.header.ChainID, Height: res.Height})
+	var result sdk.Result
+	switch routable, isRoutable := service.(sdk.Routable); {
+	case endpoint != "" && isRoutable:
+		result = routable.Routes().Query(ctx, endpoint, query.Data, snapshot)
+	case endpoint != "":
+		result = sdk.ErrorNoHandler()
+	case len(query.Data) == 0:
+		result = sdk.ResultError(sdk.BadQuery, "Error: query requires a key")
+	default:
+		result = service.Query(ctx, query.Data, snapshot)
+	}
 
+	res.Codespace = result.Codespace
 	res.Code = result.Code
 	res.Value = result.Data
 	res.Log = result.Log
 	return res
 }
 
+// queryStore returns the raw value for the key in query.Data, with
+// an IAVL existence or absence proof if requested
+func queryStore(res abci.ResponseQuery, query abci.RequestQuery, endpoint string, snapshot storage.TreeReader) abci.ResponseQuery {
+	if endpoint != "key" {
+		res.Code = sdk.BadQuery
+		res.Codespace = sdk.RootCodespace
+		res.Log = fmt.Sprintf("unknown store query '%v'", endpoint)
+		return res
+	}
+	if len(query.Data) == 0 {
+		res.Code = sdk.BadQuery
+		res.Codespace = sdk.RootCodespace
+		res.Log = "Error: query requires a key"
+		return res
+	}
+	res.Key = query.Data
+
+	if !query.Prove {
+		value, err := snapshot.Get(query.Data)
+		if err != nil {
+			res.Code = sdk.NotFound
+			res.Codespace = sdk.RootCodespace
+			res.Log = err.Error()
+			return res
+		}
+		res.Value = value
+		return res
+	}
+
+	value, proof, err := snapshot.GetWithProof(query.Data)
+	if err != nil {
+		res.Code = sdk.BadQuery
+		res.Codespace = sdk.RootCodespace
+		res.Log = err.Error()
+		return res
+	}
+	if value == nil {
+		res.Code = sdk.NotFound
+		res.Codespace = sdk.RootCodespace
+		res.Log = storage.ErrValueNotFound.Error()
+		res.ProofOps = &tmcrypto.ProofOps{Ops: []tmcrypto.ProofOp{iavl.NewAbsenceOp(query.Data, proof).ProofOp()}}
+		return res
+	}
+	res.Value = value
+	res.ProofOps = &tmcrypto.ProofOps{Ops: []tmcrypto.ProofOp{iavl.NewValueOp(query.Data, proof).ProofOp()}}
+	return res
+}
+
 // CheckTx populates the mempool. Transactions are ran through the OnValidationHandler.
 // If the pass, they will be considered for inclusion in a block and processed via
 // DeliverTx
 func (app *MentaApp) CheckTx(checkTx abci.RequestCheckTx) abci.ResponseCheckTx {
-	result := app.runTx(checkTx.Tx, true)
+	result, gas := app.runTx(checkTx.Tx, true)
 	return abci.ResponseCheckTx{
-		Code: result.Code,
-		Log:  result.Log,
-		Data: result.Data,
+		Codespace: result.Codespace,
+		Code:      result.Code,
+		Log:       result.Log,
+		Data:      result.Data,
+		GasWanted: int64(gas.GasWanted),
+		GasUsed:   int64(gas.GasUsed),
+		Events:    result.Events,
 	}
 }
 
-// BeginBlock signals the start of processing a batch of transaction via DeliverTx
+// BeginBlock signals the start of processing a batch of transaction via DeliverTx.
+// Calls BeginBlock on services that implement sdk.BeginBlocker
 func (app *MentaApp) BeginBlock(req abci.RequestBeginBlock) (resp abci.ResponseBeginBlock) {
-	// Maybe add later
+	if app.maxBlockGas > 0 {
+		app.blockGas = sdk.NewGasMeter(uint64(app.maxBlockGas))
+	} else {
+		app.blockGas = sdk.NewInfiniteGasMeter()
+	}
+	app.header = req.Header
+	app.verifyBlockTxs(req.Header.Height)
+
+	for _, service := range app.services {
+		if blocker, ok := service.(sdk.BeginBlocker); ok {
+			events := app.runBlockHook(service, "begin_block", func(ctx sdk.Context, store sdk.Cache) {
+				blocker.BeginBlock(ctx, req.Header, store)
+			})
+			resp.Events = append(resp.Events, events...)
+		}
+	}
 	return
 }
 
 // DeliverTx is the heart of processing transactions leading to a state transistion.
 // This is where the your application logic lives via handlers
 func (app *MentaApp) DeliverTx(dtx abci.RequestDeliverTx) abci.ResponseDeliverTx {
-	result := app.runTx(dtx.Tx, false)
+	result, gas := app.runTx(dtx.Tx, false)
+	app.blockGas.ConsumeGas(gas.GasUsed, "block")
 	return abci.ResponseDeliverTx{
-		Code: result.Code,
-		Log:  result.Log,
-		Data: result.Data,
+		Codespace: result.Codespace,
+		Code:      result.Code,
+		Log:       result.Log,
+		Data:      result.Data,
+		GasWanted: int64(gas.GasWanted),
+		GasUsed:   int64(gas.GasUsed),
+		Events:    result.Events,
 	}
 }
 
 // EndBlock signals the end of a block of txs.
-// TODO: return changes to the validator set
+// Calls EndBlock on services that implement sdk.EndBlocker and returns
+// validator set changes staged by the validators service
 func (app *MentaApp) EndBlock(req abci.RequestEndBlock) (resp abci.ResponseEndBlock) {
-	// Add later
+	for _, service := range app.services {
+		if blocker, ok := service.(sdk.EndBlocker); ok {
+			events := app.runBlockHook(service, "end_block", func(ctx sdk.Context, store sdk.Cache) {
+				blocker.EndBlock(ctx, req.Height, store)
+			})
+			resp.Events = append(resp.Events, events...)
+		}
+	}
+
+	updates, err := validators.EndBlock(app.cache)
+	if err != nil {
+		// Stored state is corrupt. Can't continue
+		panic(err)
+	}
+	resp.ValidatorUpdates = updates
 	return
 }
 
@@ -179,6 +553,18 @@ func (app *MentaApp) EndBlock(req abci.RequestEndBlock) (resp abci.ResponseEndBl
 func (app *MentaApp) Commit() abci.ResponseCommit {
 	commitresults := app.store.Commit(app.cache.ToBatch())
 	app.cache = storage.NewCache(app.store.Snapshot())
+	app.checkCache = storage.NewCache(app.store.Snapshot())
+
+	if app.snapshots != nil && app.snapshots.ShouldSnapshot(commitresults.Version) {
+		// The export runs in the background. The version is held in
+		// the store until it's done, so pruning doesn't delete it
+		export, err := app.snapshots.Begin(commitresults.Version)
+		if err != nil {
+			app.logger.Error("failed to create snapshot", "height", commitresults.Version, "err", err)
+		} else {
+			go app.snapshot(commitresults.Version, export)
+		}
+	}
 	return abci.ResponseCommit{Data: commitresults.Hash}
 }
 
@@ -187,25 +573,244 @@ func (app *MentaApp) SetOption(req abci.RequestSetOption) abci.ResponseSetOption
 	return abci.ResponseSetOption{}
 }
 
+// ListSnapshots returns the state sync snapshots available on this node
 func (app *MentaApp) ListSnapshots(req abci.RequestListSnapshots) abci.ResponseListSnapshots {
-	return abci.ResponseListSnapshots{}
+	resp := abci.ResponseListSnapshots{}
+	if app.snapshots == nil {
+		return resp
+	}
+	infos, err := app.snapshots.List()
+	if err != nil {
+		app.logger.Error("failed to list snapshots", "err", err)
+		return resp
+	}
+	for _, info := range infos {
+		resp.Snapshots = append(resp.Snapshots, &abci.Snapshot{
+			Height:   uint64(info.Height),
+			Format:   info.Format,
+			Chunks:   info.Chunks,
+			Hash:     info.Hash,
+			Metadata: info.Metadata,
+		})
+	}
+	return resp
 }
 
+// OfferSnapshot is called by a new node to start restoring state from a snapshot
 func (app *MentaApp) OfferSnapshot(req abci.RequestOfferSnapshot) abci.ResponseOfferSnapshot {
-	return abci.ResponseOfferSnapshot{}
+	if app.snapshots == nil {
+		return abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_ABORT}
+	}
+	if req.Snapshot == nil {
+		return abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_REJECT}
+	}
+	if req.Snapshot.Format != storage.SnapshotFormat {
+		return abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_REJECT_FORMAT}
+	}
+
+	err := app.snapshots.Restore(storage.SnapshotInfo{
+		Height:   int64(req.Snapshot.Height),
+		Format:   req.Snapshot.Format,
+		Chunks:   req.Snapshot.Chunks,
+		Hash:     req.Snapshot.Hash,
+		Metadata: req.Snapshot.Metadata,
+	})
+	if err != nil {
+		app.logger.Error("rejected snapshot", "height", req.Snapshot.Height, "err", err)
+		return abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_REJECT}
+	}
+	return abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_ACCEPT}
 }
 
+// LoadSnapshotChunk returns a chunk of a local snapshot to a peer
 func (app *MentaApp) LoadSnapshotChunk(req abci.RequestLoadSnapshotChunk) abci.ResponseLoadSnapshotChunk {
-	return abci.ResponseLoadSnapshotChunk{}
+	if app.snapshots == nil {
+		return abci.ResponseLoadSnapshotChunk{}
+	}
+	chunk, err := app.snapshots.LoadChunk(int64(req.Height), req.Format, req.Chunk)
+	if err != nil {
+		app.logger.Error("failed to load snapshot chunk", "height", req.Height, "chunk", req.Chunk, "err", err)
+		return abci.ResponseLoadSnapshotChunk{}
+	}
+	return abci.ResponseLoadSnapshotChunk{Chunk: chunk}
 }
 
+// ApplySnapshotChunk restores a chunk of the snapshot accepted in OfferSnapshot.
+// When the last chunk is applied, state is at the snapshot height
 func (app *MentaApp) ApplySnapshotChunk(req abci.RequestApplySnapshotChunk) abci.ResponseApplySnapshotChunk {
-	return abci.ResponseApplySnapshotChunk{}
+	if app.snapshots == nil {
+		return abci.ResponseApplySnapshotChunk{Result: abci.ResponseApplySnapshotChunk_ABORT}
+	}
+	done, err := app.snapshots.ApplyChunk(req.Index, req.Chunk)
+	switch {
+	case err == storage.ErrInvalidChunk:
+		return abci.ResponseApplySnapshotChunk{
+			Result:        abci.ResponseApplySnapshotChunk_RETRY,
+			RefetchChunks: []uint32{req.Index},
+			RejectSenders: []string{req.Sender},
+		}
+	case err != nil:
+		app.logger.Error("failed to apply snapshot chunk", "chunk", req.Index, "err", err)
+		return abci.ResponseApplySnapshotChunk{Result: abci.ResponseApplySnapshotChunk_ABORT}
+	}
+
+	if done {
+		app.cache = storage.NewCache(app.store.Snapshot())
+		app.checkCache = storage.NewCache(app.store.Snapshot())
+		app.maxBlockGas = loadMaxBlockGas(app.cache)
+		app.header = tmproto.Header{ChainID: loadChainID(app.cache), Height: app.store.CommitInfo.Version}
+		app.logger.Info("restored state from snapshot", "height", app.store.CommitInfo.Version)
+	}
+	return abci.ResponseApplySnapshotChunk{Result: abci.ResponseApplySnapshotChunk_ACCEPT}
+}
+
+// take a state sync snapshot. Ran in the background from Commit
+func (app *MentaApp) snapshot(height int64, export func() (*storage.SnapshotInfo, error)) {
+	info, err := export()
+	if err != nil {
+		app.logger.Error("failed to create snapshot", "height", height, "err", err)
+		return
+	}
+	app.logger.Info("created snapshot", "height", info.Height, "chunks", info.Chunks)
 }
 
-func validateForCheckTx(tx *sdk.SignedTransaction) sdk.Result {
-	if tx.Verify() {
-		return sdk.Result{}
+// runBlockHook runs a service's block hook on a branch of the block state.
+// If the hook panics, the panic is logged and its writes and events are
+// dropped, so one bad hook doesn't stop the chain
+func (app *MentaApp) runBlockHook(service sdk.Service, hook string, fn func(ctx sdk.Context, store sdk.Cache)) (events []abci.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			app.logPanic(r, "hook", hook, "service", service.Name(), "height", app.header.Height)
+			events = nil
+		}
+	}()
+	ctx := sdk.NewContext().WithBlockHeader(app.header)
+	branch := app.cache.Branch()
+	fn(ctx, branch)
+	branch.Write()
+	return ctx.EventManager().Events()
+}
+
+// logPanic logs a recovered panic with its stack trace
+func (app *MentaApp) logPanic(r interface{}, keyvals ...interface{}) {
+	keyvals = append(keyvals, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+	app.logger.Error("recovered from panic", keyvals...)
+}
+
+// verifyBlockTxs batch verifies the signatures of the block's txs, if the
+// block can be loaded. Valid txs are added to the verified cache so they're
+// skipped by the signature middleware. The bad ones are left for DeliverTx
+// to reject
+func (app *MentaApp) verifyBlockTxs(height int64) {
+	if app.blocks == nil {
+		return
+	}
+	block := app.blocks.LoadBlock(height)
+	if block == nil {
+		return
+	}
+	var txs []*sdk.SignedTransaction
+	var hashes [][]byte
+	for _, raw := range block.Txs {
+		hash := raw.Hash()
+		if app.verified.has(hash) {
+			continue
+		}
+		tx, err := sdk.DecodeTx(raw)
+		if err != nil {
+			continue
+		}
+		txs = append(txs, tx)
+		hashes = append(hashes, hash)
+	}
+	for i, ok := range sdk.VerifyBatch(txs) {
+		if ok {
+			app.verified.add(hashes[i])
+		}
+	}
+}
+
+// execute runs the tx with the service's Router, if it has one
+func execute(ctx sdk.Context, service sdk.Service, tx *sdk.SignedTransaction, store sdk.Cache) sdk.Result {
+	if routable, ok := service.(sdk.Routable); ok {
+		return routable.Routes().Execute(ctx, tx.Sender, tx.Msgid, tx.Msg, store)
+	}
+	return service.Execute(ctx, tx.Sender, tx.Msgid, tx.Msg, store)
+}
+
+// genesisSections splits the genesis app state into the section for each service
+func genesisSections(appState []byte) (map[string]json.RawMessage, error) {
+	sections := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(appState)) == 0 {
+		return sections, nil
+	}
+	if err := json.Unmarshal(appState, &sections); err != nil {
+		return nil, fmt.Errorf("genesis: app state must be a JSON object keyed by service name: %w", err)
+	}
+	// 'null' unmarshals to a nil map
+	if sections == nil {
+		sections = make(map[string]json.RawMessage)
+	}
+	return sections, nil
+}
+
+// validateServiceName checks that the service's keys, stored under its name,
+// can't overlap with another's
+func validateServiceName(name string, services []sdk.Service) error {
+	if name == "" {
+		return fmt.Errorf("service name is empty")
 	}
-	return sdk.ResultError(1, "Tx failed validation")
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("service name '%v' contains a '/'", name)
+	}
+	for _, other := range services {
+		if other.Name() != name && (strings.HasPrefix(name, other.Name()) || strings.HasPrefix(other.Name(), name)) {
+			return fmt.Errorf("service name '%v' overlaps with service '%v'", name, other.Name())
+		}
+	}
+	return nil
+}
+
+// splitQueryPath returns the service and optional query name from 'service/query'
+func splitQueryPath(path string) (string, string) {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// txEvent has the standard attributes added to every tx
+func txEvent(tx *sdk.SignedTransaction) abci.Event {
+	return sdk.NewEvent(sdk.EventTypeTx,
+		sdk.NewAttribute(sdk.AttributeKeyService, tx.Service),
+		sdk.NewAttribute(sdk.AttributeKeySender, hex.EncodeToString(tx.Sender)),
+		sdk.NewAttribute(sdk.AttributeKeyMsgID, strconv.FormatUint(uint64(tx.Msgid), 10)),
+	)
+}
+
+func loadMaxBlockGas(store sdk.Cache) int64 {
+	bits, err := store.Get(maxBlockGasKey)
+	if err != nil || len(bits) != 8 {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(bits))
+}
+
+func saveMaxBlockGas(store sdk.Cache, maxGas int64) {
+	bits := make([]byte, 8)
+	binary.BigEndian.PutUint64(bits, uint64(maxGas))
+	store.Put(maxBlockGasKey, bits)
+}
+
+func loadChainID(store sdk.Cache) string {
+	bits, err := store.Get(chainIDKey)
+	if err != nil {
+		return ""
+	}
+	return string(bits)
+}
+
+func saveChainID(store sdk.Cache, chainID string) {
+	store.Put(chainIDKey, []byte(chainID))
 }
@@ -1,11 +1,31 @@
 package app
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/cosmos/iavl"
+	"github.com/davebryson/menta/crypto"
 	"github.com/davebryson/menta/examples/services/counter"
+	"github.com/davebryson/menta/services/accounts"
+	"github.com/davebryson/menta/services/validators"
+	"github.com/davebryson/menta/storage"
+	sdk "github.com/davebryson/menta/types"
+	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
 	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 func createApp() *MentaApp {
@@ -47,7 +67,9 @@ func TestAppCallbacks(t *testing.T) {
 	tx, err := alice.NewTx(1)
 	assert.Nil(err)
 	chtx := app.CheckTx(abci.RequestCheckTx{Tx: tx})
-	assert.Equal(abci.ResponseCheckTx{Code: 0}, chtx)
+	assert.Equal(uint32(0), chtx.Code)
+	assert.Equal(int64(sdk.DefaultGasLimit), chtx.GasWanted)
+	assert.True(chtx.GasUsed > 0)
 
 	// Run Deliver handlers
 	dtx := app.DeliverTx(abci.RequestDeliverTx{Tx: tx})
@@ -68,3 +90,1077 @@ func TestAppCallbacks(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(uint32(1), count.Current)
 }
+
+func TestNonceReplay(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	app.InitChain(abci.RequestInitChain{})
+	app.Commit()
+
+	alice := counter.CreateWallet()
+	tx1, err := alice.NewTx(1)
+	assert.Nil(err)
+	tx2, err := alice.NewTx(2)
+	assert.Nil(err)
+
+	// Duplicates are rejected by CheckTx
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx1}).Code)
+	assert.Equal(accounts.ErrBadNonce.Code(), app.CheckTx(abci.RequestCheckTx{Tx: tx1}).Code)
+	// Next nonce is accepted against the pending check state
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx2}).Code)
+
+	// ... and by DeliverTx
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx1}).Code)
+	replayed := app.DeliverTx(abci.RequestDeliverTx{Tx: tx1})
+	assert.Equal(accounts.ServiceName, replayed.Codespace)
+	assert.Equal(accounts.ErrBadNonce.Code(), replayed.Code)
+	assert.Equal("expected 1 got 0: bad nonce", replayed.Log)
+	app.Commit()
+
+	// Check state is reset on commit: tx1 is now stale, tx2 is still valid
+	assert.Equal(accounts.ErrBadNonce.Code(), app.CheckTx(abci.RequestCheckTx{Tx: tx1}).Code)
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx2}).Code)
+
+	// The next nonce is queryable
+	resp := app.Query(abci.RequestQuery{Path: accounts.ServiceName, Data: alice.PubKey()})
+	assert.Equal(sdk.OK, resp.Code)
+	assert.Equal(accounts.EncodeNonce(1), resp.Value)
+}
+
+func TestServiceCheck(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+
+	alice := counter.CreateWallet()
+	tx1, err := alice.NewTx(1)
+	assert.Nil(err)
+	// Wrong next value
+	bad, err := alice.NewTx(3)
+	assert.Nil(err)
+	alice.SetNonce(1)
+	tx2, err := alice.NewTx(2)
+	assert.Nil(err)
+
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx1}).Code)
+	resp := app.CheckTx(abci.RequestCheckTx{Tx: bad})
+	assert.Equal(uint32(2), resp.Code)
+	assert.Equal("bad count", resp.Log)
+	assert.Equal(counter.ServiceName, resp.Codespace)
+	assert.True(errors.Is(sdk.ABCIError(resp.Codespace, resp.Code, resp.Log), counter.ErrBadCount))
+	// Checked against pending state of tx1
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx2}).Code)
+
+	// Check state doesn't leak into deliver state
+	app.Commit()
+	respQ := app.Query(abci.RequestQuery{Path: counter.ServiceName, Data: alice.PubKey()})
+	assert.NotEqual(sdk.OK, respQ.Code)
+}
+
+// blockService records calls to its block hooks
+type blockService struct {
+	name  string
+	calls *[]string
+}
+
+func (srv blockService) Name() string { return srv.name }
+func (srv blockService) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	return nil
+}
+func (srv blockService) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	return sdk.ErrorNoHandler()
+}
+func (srv blockService) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
+	val, err := store.Get([]byte(srv.name))
+	if err != nil {
+		return sdk.ResultError(sdk.NotFound, err.Error())
+	}
+	return sdk.Result{Data: val}
+}
+
+func (srv blockService) BeginBlock(ctx sdk.Context, header tmproto.Header, store sdk.Cache) {
+	*srv.calls = append(*srv.calls, srv.name+"-begin")
+	store.Put([]byte(srv.name), []byte(header.ChainID))
+	ctx.EventManager().EmitEvent(sdk.NewEvent("begin", sdk.NewAttribute("service", srv.name)))
+}
+
+func (srv blockService) EndBlock(ctx sdk.Context, height int64, store sdk.Cache) {
+	*srv.calls = append(*srv.calls, srv.name+"-end")
+}
+
+func TestBlockHooks(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	app := NewMockApp()
+	for _, name := range []string{"one", "two", "three"} {
+		app.AddService(blockService{name: name, calls: &calls})
+	}
+
+	begin := app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{ChainID: "hooks", Height: 1}})
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	// Called in registration order
+	assert.Equal([]string{"one-begin", "two-begin", "three-begin", "one-end", "two-end", "three-end"}, calls)
+	assert.Equal(3, len(begin.Events))
+	assert.Equal(sdk.NewEvent("begin", sdk.NewAttribute("service", "one")), begin.Events[0])
+
+	// Writes are committed with the block
+	resp := app.Query(abci.RequestQuery{Path: "two", Data: []byte("two")})
+	assert.Equal(sdk.OK, resp.Code)
+	assert.Equal([]byte("hooks"), resp.Value)
+}
+
+func signTx(sk crypto.PrivateKeyEd25519, service string, msgid uint32, msg proto.Message, nonce uint64) []byte {
+	encoded, err := proto.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	tx := &sdk.SignedTransaction{
+		Service:  service,
+		Msgid:    msgid,
+		Msg:      encoded,
+		Nonce:    accounts.EncodeNonce(nonce),
+		GasLimit: sdk.DefaultGasLimit,
+	}
+	tx.Sign(sk)
+	bits, err := sdk.EncodeTx(tx)
+	if err != nil {
+		panic(err)
+	}
+	return bits
+}
+
+func TestValidatorUpdates(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+
+	admin := crypto.GeneratePrivateKey()
+	genesisVal := ed25519.GenPrivKey().PubKey().Bytes()
+	newVal := ed25519.GenPrivKey().PubKey().Bytes()
+
+	app.InitChain(abci.RequestInitChain{
+		Validators:    []abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(genesisVal, 10)},
+		AppStateBytes: []byte(fmt.Sprintf(`{"validators": {"admins": ["%v"]}}`, admin.PubKey().ToHex())),
+	})
+	app.Commit()
+
+	querySet := func() *validators.ValidatorSet {
+		resp := app.Query(abci.RequestQuery{Path: validators.ServiceName, Data: validators.QuerySet})
+		assert.Equal(sdk.OK, resp.Code)
+		var set validators.ValidatorSet
+		assert.Nil(proto.Unmarshal(resp.Value, &set))
+		return &set
+	}
+	assert.Equal(1, len(querySet().Validators))
+
+	// Only admins can update
+	notAdmin := crypto.GeneratePrivateKey()
+	tx := signTx(notAdmin, validators.ServiceName, validators.MsgUpdate, &validators.Validator{PubKey: newVal, Power: 5}, 0)
+	failed := app.DeliverTx(abci.RequestDeliverTx{Tx: tx})
+	assert.Equal(validators.ServiceName, failed.Codespace)
+	assert.True(errors.Is(sdk.ABCIError(failed.Codespace, failed.Code, failed.Log), validators.ErrNotAdmin))
+
+	tx = signTx(admin, validators.ServiceName, validators.MsgUpdate, &validators.Validator{PubKey: newVal, Power: 5}, 0)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	resp := app.EndBlock(abci.RequestEndBlock{Height: 2})
+	assert.Equal([]abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(newVal, 5)}, resp.ValidatorUpdates)
+	app.Commit()
+
+	set := querySet()
+	assert.Equal(2, len(set.Validators))
+
+	// Remove both: the last one is rejected
+	tx = signTx(admin, validators.ServiceName, validators.MsgUpdate, &validators.Validator{PubKey: genesisVal}, 1)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	tx = signTx(admin, validators.ServiceName, validators.MsgUpdate, &validators.Validator{PubKey: newVal}, 2)
+	assert.Equal(validators.ErrLastValidator.Code(), app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	resp = app.EndBlock(abci.RequestEndBlock{Height: 3})
+	assert.Equal([]abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(genesisVal, 0)}, resp.ValidatorUpdates)
+	app.Commit()
+
+	set = querySet()
+	assert.Equal(1, len(set.Validators))
+	assert.Equal(newVal, set.Validators[0].PubKey)
+	// Nothing staged
+	assert.Nil(app.EndBlock(abci.RequestEndBlock{Height: 4}).ValidatorUpdates)
+}
+
+func TestGasLimits(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	app.InitChain(abci.RequestInitChain{
+		ConsensusParams: &abci.ConsensusParams{Block: &abci.BlockParams{MaxBytes: 22020096, MaxGas: 105000}},
+	})
+	app.Commit()
+
+	alice := crypto.GeneratePrivateKey()
+	counterTx := func(value uint32, nonce uint64, gasLimit uint64) []byte {
+		encoded, err := counter.NewCounter(value).Encode()
+		assert.Nil(err)
+		tx := &sdk.SignedTransaction{
+			Service:  counter.ServiceName,
+			Msg:      encoded,
+			Nonce:    accounts.EncodeNonce(nonce),
+			GasLimit: gasLimit,
+		}
+		assert.Nil(tx.Sign(alice))
+		bits, err := sdk.EncodeTx(tx)
+		assert.Nil(err)
+		return bits
+	}
+
+	// More than the block max gas
+	resp := app.CheckTx(abci.RequestCheckTx{Tx: counterTx(1, 0, 200000)})
+	assert.Equal(sdk.OutOfGas, resp.Code)
+
+	// Runs out of gas in the service
+	app.BeginBlock(abci.RequestBeginBlock{})
+	dtx := app.DeliverTx(abci.RequestDeliverTx{Tx: counterTx(1, 0, 1500)})
+	assert.Equal(sdk.OutOfGas, dtx.Code)
+	assert.Equal(int64(1500), dtx.GasWanted)
+	assert.Equal(int64(1500), dtx.GasUsed)
+
+	dtx = app.DeliverTx(abci.RequestDeliverTx{Tx: counterTx(1, 1, 100000)})
+	assert.Equal(sdk.OK, dtx.Code)
+	assert.True(dtx.GasUsed > 1500)
+
+	// Not enough gas left in the block for the gas limit
+	dtx = app.DeliverTx(abci.RequestDeliverTx{Tx: counterTx(2, 2, 100000)})
+	assert.Equal(sdk.OutOfGas, dtx.Code)
+	app.EndBlock(abci.RequestEndBlock{})
+	app.Commit()
+
+	// The next block has a fresh block gas meter
+	app.BeginBlock(abci.RequestBeginBlock{})
+	dtx = app.DeliverTx(abci.RequestDeliverTx{Tx: counterTx(2, 2, 100000)})
+	assert.Equal(sdk.OK, dtx.Code)
+}
+
+func TestZeroGasLimit(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	app.InitChain(abci.RequestInitChain{})
+	app.Commit()
+
+	encoded, err := counter.NewCounter(1).Encode()
+	assert.Nil(err)
+	tx := &sdk.SignedTransaction{
+		Service: counter.ServiceName,
+		Msg:     encoded,
+		Nonce:   accounts.EncodeNonce(0),
+	}
+	assert.Nil(tx.Sign(crypto.GeneratePrivateKey()))
+	bits, err := sdk.EncodeTx(tx)
+	assert.Nil(err)
+
+	// A tx without a gas limit runs with the default
+	chtx := app.CheckTx(abci.RequestCheckTx{Tx: bits})
+	assert.Equal(sdk.OK, chtx.Code)
+	assert.Equal(int64(sdk.DefaultGasLimit), chtx.GasWanted)
+
+	app.BeginBlock(abci.RequestBeginBlock{})
+	dtx := app.DeliverTx(abci.RequestDeliverTx{Tx: bits})
+	assert.Equal(sdk.OK, dtx.Code)
+	assert.Equal(int64(sdk.DefaultGasLimit), dtx.GasWanted)
+	assert.True(dtx.GasUsed > 0)
+}
+
+// writeService writes the message to the store and then fails for msgid > 1
+type writeService struct{}
+
+func (srv writeService) Name() string { return "write" }
+func (srv writeService) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	return nil
+}
+func (srv writeService) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	store.Put([]byte("write"), message)
+	switch msgid {
+	case 2:
+		return sdk.ErrorBadTx()
+	case 3:
+		// Keep writing until out of gas
+		for {
+			store.Put([]byte("write/more"), message)
+		}
+	}
+	return sdk.Result{}
+}
+func (srv writeService) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
+	val, err := store.Get([]byte("write"))
+	if err != nil {
+		return sdk.ResultError(sdk.NotFound, err.Error())
+	}
+	return sdk.Result{Data: val}
+}
+
+func TestFailedTxRollback(t *testing.T) {
+	assert := assert.New(t)
+	app := NewMockApp()
+	app.AddService(writeService{})
+	alice := crypto.GeneratePrivateKey()
+
+	query := func() abci.ResponseQuery {
+		return app.Query(abci.RequestQuery{Path: "write", Data: []byte("write")})
+	}
+
+	app.BeginBlock(abci.RequestBeginBlock{})
+	// Fails after writing
+	tx := signTx(alice, "write", 2, &abci.RequestEcho{Message: "bad"}, 0)
+	assert.Equal(sdk.BadTx, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	// Runs out of gas after writing
+	tx = signTx(alice, "write", 3, &abci.RequestEcho{Message: "gas"}, 1)
+	assert.Equal(sdk.OutOfGas, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	app.EndBlock(abci.RequestEndBlock{})
+	app.Commit()
+
+	assert.Equal(sdk.NotFound, query().Code)
+	_, err := app.store.Snapshot().Get([]byte("write/more"))
+	assert.NotNil(err)
+
+	// Nonces are still used by failed txs
+	nonce := app.Query(abci.RequestQuery{Path: accounts.ServiceName, Data: alice.PubKey().Bytes()})
+	assert.Equal(accounts.EncodeNonce(2), nonce.Value)
+
+	// A good tx in the same block as a failed one
+	app.BeginBlock(abci.RequestBeginBlock{})
+	tx = signTx(alice, "write", 1, &abci.RequestEcho{Message: "good"}, 2)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	tx = signTx(alice, "write", 2, &abci.RequestEcho{Message: "bad"}, 3)
+	assert.Equal(sdk.BadTx, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	app.EndBlock(abci.RequestEndBlock{})
+	app.Commit()
+
+	resp := query()
+	assert.Equal(sdk.OK, resp.Code)
+	var msg abci.RequestEcho
+	assert.Nil(proto.Unmarshal(resp.Value, &msg))
+	assert.Equal("good", msg.Message)
+}
+
+func TestTxEvents(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	alice := counter.CreateWallet()
+	sender := hex.EncodeToString(alice.PubKey())
+
+	txEvent := sdk.NewEvent(sdk.EventTypeTx,
+		sdk.NewAttribute(sdk.AttributeKeyService, counter.ServiceName),
+		sdk.NewAttribute(sdk.AttributeKeySender, sender),
+		sdk.NewAttribute(sdk.AttributeKeyMsgID, "0"),
+	)
+
+	tx, err := alice.NewTx(1)
+	assert.Nil(err)
+	resp := app.DeliverTx(abci.RequestDeliverTx{Tx: tx})
+	assert.Equal(sdk.OK, resp.Code)
+	assert.Equal([]abci.Event{
+		txEvent,
+		sdk.NewEvent(counter.ServiceName,
+			sdk.NewAttribute("sender", sender),
+			sdk.NewAttribute("count", "1"),
+		),
+	}, resp.Events)
+
+	// Events emitted by a failed tx are dropped
+	tx, err = alice.NewTx(5)
+	assert.Nil(err)
+	resp = app.DeliverTx(abci.RequestDeliverTx{Tx: tx})
+	assert.NotEqual(sdk.OK, resp.Code)
+	assert.Equal([]abci.Event{txEvent}, resp.Events)
+}
+
+func TestServiceNames(t *testing.T) {
+	assert := assert.New(t)
+	app := NewMockApp()
+	app.AddService(blockService{name: "one"})
+
+	// Keys or query paths would overlap
+	for _, name := range []string{"", "a/b", "one_v2", "on", accounts.ServiceName + "2"} {
+		assert.Panics(func() { app.AddService(blockService{name: name}) }, name)
+	}
+	// Duplicates and 'store' are ignored
+	app.AddService(blockService{name: "one"})
+	app.AddService(blockService{name: storeQueryPath})
+	assert.Equal(3, len(app.services))
+}
+
+func TestRouter(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	alice := crypto.GeneratePrivateKey()
+
+	// Unknown msgid
+	tx := signTx(alice, counter.ServiceName, 9, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.HandlerNotFound, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	// Msg doesn't decode
+	bad := &sdk.SignedTransaction{
+		Service:  counter.ServiceName,
+		Msgid:    counter.MsgIncrement,
+		Msg:      []byte{0xff, 0xff},
+		Nonce:    accounts.EncodeNonce(1),
+		GasLimit: sdk.DefaultGasLimit,
+	}
+	assert.Nil(bad.Sign(alice))
+	tx, err := sdk.EncodeTx(bad)
+	assert.Nil(err)
+	assert.Equal(sdk.BadTx, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+
+	tx = signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 2)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	app.Commit()
+
+	// Typed query
+	req, err := proto.Marshal(&counter.CountQuery{Sender: alice.PubKey().Bytes()})
+	assert.Nil(err)
+	resp := app.Query(abci.RequestQuery{Path: counter.ServiceName + "/" + counter.QueryCount, Data: req})
+	assert.Equal(sdk.OK, resp.Code)
+	count, err := counter.DecodeCount(resp.Value)
+	assert.Nil(err)
+	assert.Equal(uint32(1), count.Current)
+
+	// Unknown queries
+	resp = app.Query(abci.RequestQuery{Path: counter.ServiceName + "/nope", Data: req})
+	assert.Equal(sdk.HandlerNotFound, resp.Code)
+	resp = app.Query(abci.RequestQuery{Path: accounts.ServiceName + "/nope", Data: req})
+	assert.Equal(sdk.HandlerNotFound, resp.Code)
+}
+
+func TestQueryPaths(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	alice := counter.CreateWallet()
+
+	for i := uint32(1); i <= 2; i++ {
+		tx, err := alice.NewTx(i)
+		assert.Nil(err)
+		assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+		app.Commit()
+	}
+	root := app.store.CommitInfo.Hash
+
+	req, err := proto.Marshal(&counter.CountQuery{Sender: alice.PubKey()})
+	assert.Nil(err)
+	queryCount := func(height int64) uint32 {
+		resp := app.Query(abci.RequestQuery{Path: "/counter_example/count", Data: req, Height: height})
+		assert.Equal(sdk.OK, resp.Code)
+		count, err := counter.DecodeCount(resp.Value)
+		assert.Nil(err)
+		return count.Current
+	}
+	// Latest and historical heights
+	assert.Equal(uint32(2), queryCount(0))
+	assert.Equal(uint32(2), queryCount(2))
+	assert.Equal(uint32(1), queryCount(1))
+	resp := app.Query(abci.RequestQuery{Path: "/counter_example/count", Data: req, Height: 10})
+	assert.Equal(sdk.BadQuery, resp.Code)
+
+	// Raw store query with an existence proof
+	key := sdk.PrefixedKey([]byte(counter.ServiceName), alice.PubKey())
+	resp = app.Query(abci.RequestQuery{Path: "/store/key", Data: key, Prove: true})
+	assert.Equal(sdk.OK, resp.Code)
+	assert.Equal(int64(2), resp.Height)
+	assert.NotNil(resp.ProofOps)
+
+	prt := merkle.DefaultProofRuntime()
+	prt.RegisterOpDecoder(iavl.ProofOpIAVLValue, iavl.ValueOpDecoder)
+	prt.RegisterOpDecoder(iavl.ProofOpIAVLAbsence, iavl.AbsenceOpDecoder)
+	keypath := merkle.KeyPath{}.AppendKey(key, merkle.KeyEncodingURL).String()
+	assert.Nil(prt.VerifyValue(resp.ProofOps, root, keypath, resp.Value))
+	assert.NotNil(prt.VerifyValue(resp.ProofOps, root, keypath, []byte("nope")))
+
+	// Absence proof
+	missing := []byte("missing")
+	resp = app.Query(abci.RequestQuery{Path: "/store/key", Data: missing, Prove: true})
+	assert.Equal(sdk.NotFound, resp.Code)
+	keypath = merkle.KeyPath{}.AppendKey(missing, merkle.KeyEncodingURL).String()
+	assert.Nil(prt.VerifyAbsence(resp.ProofOps, root, keypath))
+
+	// Without a proof
+	resp = app.Query(abci.RequestQuery{Path: "/store/key", Data: key})
+	assert.Equal(sdk.OK, resp.Code)
+	assert.Nil(resp.ProofOps)
+	count, err := counter.DecodeCount(resp.Value)
+	assert.Nil(err)
+	assert.Equal(uint32(2), count.Current)
+}
+
+func TestAppOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	// Snapshots need a home dir
+	_, err := NewApp("opts", WithSnapshotInterval(10))
+	assert.NotNil(err)
+	_, err = NewApp("opts", WithSigCacheSize(-1))
+	assert.NotNil(err)
+
+	// Verified txs aren't remembered without a sig cache
+	noCache := NewMockApp(WithSigCacheSize(0))
+	noCache.AddService(&counter.Service{})
+	bob := crypto.GeneratePrivateKey()
+	bobTx := signTx(bob, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, noCache.CheckTx(abci.RequestCheckTx{Tx: bobTx}).Code)
+	assert.False(noCache.verified.has(tmhash.Sum(bobTx)))
+
+	store, err := storage.NewStoreWithOptions("", storage.Options{Pruning: storage.PruningOptions{}})
+	assert.Nil(err)
+
+	app := NewMockApp(WithStore(store))
+	app.AddService(&counter.Service{})
+	alice := crypto.GeneratePrivateKey()
+	tx := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+
+	// The app commits to the injected store, which keeps every version
+	for i := 0; i < 3; i++ {
+		app.Commit()
+	}
+	assert.Equal([]int64{1, 2, 3}, store.Versions())
+}
+
+type limitKey struct{}
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	// Passes a limit on to the next middleware, which rejects txs over it
+	var order []string
+	setLimit := func(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool, next sdk.AnteHandler) sdk.Result {
+		order = append(order, "limit")
+		return next(ctx.WithValue(limitKey{}, 6), tx, store, isCheck)
+	}
+	checkMsgid := func(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool, next sdk.AnteHandler) sdk.Result {
+		order = append(order, "msgid")
+		if tx.Msgid > uint32(ctx.Value(limitKey{}).(int)) {
+			return sdk.ResultError(sdk.Unauthorized, "msgid is over the limit")
+		}
+		result := next(ctx, tx, store, isCheck)
+		order = append(order, "after")
+		return result
+	}
+	app := NewMockApp(WithMiddleware(setLimit, checkMsgid))
+	app.AddService(&counter.Service{})
+	alice := crypto.GeneratePrivateKey()
+
+	tx := signTx(alice, counter.ServiceName, 7, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.Unauthorized, app.CheckTx(abci.RequestCheckTx{Tx: tx}).Code)
+	assert.Equal([]string{"limit", "msgid"}, order)
+
+	// Rejected by middleware in CheckTx so the nonce isn't used
+	order = nil
+	tx = signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: tx}).Code)
+	assert.Equal([]string{"limit", "msgid", "after"}, order)
+
+	// The default middleware runs first. A bad nonce never reaches ours
+	order = nil
+	tx = signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(accounts.ErrBadNonce.Code(), app.CheckTx(abci.RequestCheckTx{Tx: tx}).Code)
+	assert.Empty(order)
+
+	// In DeliverTx the nonce is used even though the middleware rejects the tx
+	tx = signTx(alice, counter.ServiceName, 7, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.Unauthorized, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	assert.Equal(accounts.ErrBadNonce.Code(), app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	tx = signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 1)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+}
+
+// recordingCache records the keys put by the service
+type recordingCache struct {
+	sdk.Cache
+	puts *[]string
+}
+
+func (rc recordingCache) Put(key, value []byte) {
+	*rc.puts = append(*rc.puts, string(key))
+	rc.Cache.Put(key, value)
+}
+
+func TestMiddlewareStore(t *testing.T) {
+	assert := assert.New(t)
+
+	// The service runs on the store passed to the end of the chain
+	var puts []string
+	record := func(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool, next sdk.AnteHandler) sdk.Result {
+		return next(ctx, tx, recordingCache{Cache: store, puts: &puts}, isCheck)
+	}
+	app := NewMockApp(WithMiddleware(record))
+	app.AddService(&counter.Service{})
+	alice := crypto.GeneratePrivateKey()
+
+	tx := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	assert.Equal([]string{string(sdk.PrefixedKey([]byte(counter.ServiceName), alice.PubKey().Bytes()))}, puts)
+
+	// Nothing is written through it when the service fails
+	puts = nil
+	tx = signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 5}, 1)
+	assert.Equal(uint32(2), app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	assert.Empty(puts)
+}
+
+func TestDeliverTxSignature(t *testing.T) {
+	assert := assert.New(t)
+	app := createApp()
+	alice := crypto.GeneratePrivateKey()
+	bob := crypto.GeneratePrivateKey()
+
+	// Bob signs a tx claiming to be from alice
+	encoded, err := proto.Marshal(&counter.Increment{Value: 1})
+	assert.Nil(err)
+	tx := &sdk.SignedTransaction{
+		Service:  counter.ServiceName,
+		Msgid:    counter.MsgIncrement,
+		Msg:      encoded,
+		Nonce:    accounts.EncodeNonce(0),
+		GasLimit: sdk.DefaultGasLimit,
+	}
+	assert.Nil(tx.Sign(bob))
+	tx.Sender = alice.PubKey().Bytes()
+	forged, err := sdk.EncodeTx(tx)
+	assert.Nil(err)
+	assert.Equal(sdk.Unauthorized, app.CheckTx(abci.RequestCheckTx{Tx: forged}).Code)
+	assert.Equal(sdk.Unauthorized, app.DeliverTx(abci.RequestDeliverTx{Tx: forged}).Code)
+
+	// Verified in CheckTx and then delivered
+	signed := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.CheckTx(abci.RequestCheckTx{Tx: signed}).Code)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: signed}).Code)
+}
+
+func TestSigCache(t *testing.T) {
+	assert := assert.New(t)
+	c := newSigCache(2)
+	c.add([]byte("a"))
+	c.add([]byte("b"))
+	assert.True(c.has([]byte("a")))
+
+	// Evicts the oldest
+	c.add([]byte("c"))
+	assert.False(c.has([]byte("a")))
+	assert.True(c.has([]byte("b")))
+	assert.True(c.has([]byte("c")))
+
+	c.remove([]byte("b"))
+	assert.False(c.has([]byte("b")))
+
+	// A hash removed and added again keeps its new slot. The old slot is
+	// reused without evicting it
+	c = newSigCache(3)
+	for _, h := range []string{"a", "b", "c"} {
+		c.add([]byte(h))
+	}
+	c.remove([]byte("b"))
+	c.add([]byte("b"))
+	assert.False(c.has([]byte("a")))
+	c.add([]byte("d"))
+	assert.True(c.has([]byte("b")))
+	assert.True(c.has([]byte("c")))
+	assert.True(c.has([]byte("d")))
+
+	// Disabled with a size of 0
+	c = newSigCache(0)
+	c.add([]byte("a"))
+	assert.False(c.has([]byte("a")))
+}
+
+// blockSource serves blocks from memory
+type blockSource map[int64]*tmtypes.Block
+
+func (bs blockSource) LoadBlock(height int64) *tmtypes.Block { return bs[height] }
+
+func TestBlockBatchVerify(t *testing.T) {
+	assert := assert.New(t)
+	alice := crypto.GeneratePrivateKey()
+	good := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	bad := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 2}, 1)
+	tx, err := sdk.DecodeTx(bad)
+	assert.Nil(err)
+	tx.Sig[0] ^= 0x01
+	bad, err = sdk.EncodeTx(tx)
+	assert.Nil(err)
+
+	blocks := blockSource{1: &tmtypes.Block{Data: tmtypes.Data{Txs: tmtypes.Txs{good, bad}}}}
+	app := NewMockApp(WithBlockSource(blocks))
+	app.AddService(&counter.Service{})
+
+	app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{Height: 1}})
+	assert.True(app.verified.has(tmhash.Sum(good)))
+	assert.False(app.verified.has(tmhash.Sum(bad)))
+
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: good}).Code)
+	assert.False(app.verified.has(tmhash.Sum(good)))
+	assert.Equal(sdk.Unauthorized, app.DeliverTx(abci.RequestDeliverTx{Tx: bad}).Code)
+}
+
+// contextService records the ctx it's called with
+type contextService struct {
+	seen map[string]sdk.Context
+}
+
+func (srv contextService) Name() string { return "context" }
+func (srv contextService) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	srv.seen["init"] = ctx
+	return nil
+}
+func (srv contextService) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	srv.seen["execute"] = ctx
+	return sdk.Result{}
+}
+func (srv contextService) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
+	srv.seen["query"] = ctx
+	return sdk.Result{}
+}
+
+func TestBlockContext(t *testing.T) {
+	assert := assert.New(t)
+	store := storage.NewMemStore()
+	srv := contextService{seen: map[string]sdk.Context{}}
+	app := NewMockApp(WithStore(store))
+	app.AddService(srv)
+
+	genesisTime := time.Unix(1600000000, 0).UTC()
+	app.InitChain(abci.RequestInitChain{ChainId: "ctx-chain", Time: genesisTime, InitialHeight: 1})
+	assert.Equal("ctx-chain", srv.seen["init"].ChainID())
+	assert.Equal(genesisTime, srv.seen["init"].BlockTime())
+
+	blockTime := genesisTime.Add(time.Minute)
+	proposer := []byte("proposer-address")
+	app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{
+		ChainID:         "ctx-chain",
+		Height:          1,
+		Time:            blockTime,
+		ProposerAddress: proposer,
+	}})
+	tx := signTx(crypto.GeneratePrivateKey(), "context", 0, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+
+	ctx := srv.seen["execute"]
+	assert.Equal("ctx-chain", ctx.ChainID())
+	assert.Equal(int64(1), ctx.BlockHeight())
+	assert.Equal(blockTime, ctx.BlockTime())
+	assert.Equal(proposer, ctx.ProposerAddress())
+	assert.Equal(tmhash.Sum(tx), ctx.TxHash())
+
+	app.Query(abci.RequestQuery{Path: "context", Data: []byte("key")})
+	assert.Equal("ctx-chain", srv.seen["query"].ChainID())
+	assert.Equal(int64(1), srv.seen["query"].BlockHeight())
+
+	// The chain-id is kept in state for restarts
+	restarted := NewMockApp(WithStore(store))
+	restarted.AddService(srv)
+	restarted.Query(abci.RequestQuery{Path: "context", Data: []byte("key")})
+	assert.Equal("ctx-chain", srv.seen["query"].ChainID())
+}
+
+// genesisService keeps its genesis section, and fails if it's "bad"
+type genesisService struct {
+	blockService
+}
+
+func (srv genesisService) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	if string(data) == `"bad"` {
+		return fmt.Errorf("bad genesis")
+	}
+	if data != nil {
+		store.Put([]byte(srv.name), data)
+	}
+	return nil
+}
+
+func TestGenesis(t *testing.T) {
+	assert := assert.New(t)
+	newApp := func() *MentaApp {
+		app := NewMockApp()
+		for _, name := range []string{"one", "two"} {
+			app.AddService(genesisService{blockService{name: name}})
+		}
+		return app
+	}
+
+	// Each service gets only its own section
+	app := newApp()
+	val := ed25519.GenPrivKey().PubKey().Bytes()
+	resp := app.InitChain(abci.RequestInitChain{AppStateBytes: []byte(fmt.Sprintf(`{
+		"one": {"value": 1},
+		"validators": {"validators": [{"pub_key": "%x", "power": 10}]}
+	}`, val))})
+	app.Commit()
+	query := app.Query(abci.RequestQuery{Path: "one", Data: []byte("one")})
+	assert.Equal(`{"value": 1}`, string(query.Value))
+	query = app.Query(abci.RequestQuery{Path: "two", Data: []byte("two")})
+	assert.Equal(sdk.NotFound, query.Code)
+
+	// Validators in the app state are the initial set
+	assert.Equal([]abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(val, 10)}, resp.Validators)
+
+	// Without them the genesis file validators are used
+	resp = newApp().InitChain(abci.RequestInitChain{
+		Validators: []abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(val, 10)},
+	})
+	assert.Empty(resp.Validators)
+
+	// Errors stop the chain
+	assert.Panics(func() {
+		newApp().InitChain(abci.RequestInitChain{AppStateBytes: []byte(`{"two": "bad"}`)})
+	})
+	assert.Panics(func() {
+		newApp().InitChain(abci.RequestInitChain{AppStateBytes: []byte(`{"three": {}}`)})
+	})
+	assert.Panics(func() {
+		newApp().InitChain(abci.RequestInitChain{AppStateBytes: []byte(`[1, 2]`)})
+	})
+	assert.Panics(func() {
+		newApp().InitChain(abci.RequestInitChain{AppStateBytes: []byte(`{"validators": {"validators": [{"pub_key": "aa", "power": 1}]}}`)})
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	assert := assert.New(t)
+	admin := crypto.GeneratePrivateKey()
+	val := ed25519.GenPrivKey().PubKey()
+	doc := &tmtypes.GenesisDoc{
+		ChainID:         "export-chain",
+		GenesisTime:     time.Unix(1600000000, 0).UTC(),
+		ConsensusParams: tmtypes.DefaultConsensusParams(),
+		Validators:      []tmtypes.GenesisValidator{{Address: val.Address(), PubKey: val, Power: 10}},
+		AppState:        []byte(fmt.Sprintf(`{"validators": {"admins": ["%v"]}}`, admin.PubKey().ToHex())),
+	}
+	assert.Nil(doc.ValidateAndComplete())
+
+	initChain := func(app *MentaApp, doc *tmtypes.GenesisDoc) abci.ResponseInitChain {
+		vals := make([]*tmtypes.Validator, 0, len(doc.Validators))
+		for _, v := range doc.Validators {
+			vals = append(vals, tmtypes.NewValidator(v.PubKey, v.Power))
+		}
+		return app.InitChain(abci.RequestInitChain{
+			ChainId:         doc.ChainID,
+			Time:            doc.GenesisTime,
+			InitialHeight:   doc.InitialHeight,
+			AppStateBytes:   doc.AppState,
+			Validators:      tmtypes.TM2PB.ValidatorUpdates(tmtypes.NewValidatorSet(vals)),
+			ConsensusParams: tmtypes.TM2PB.ConsensusParams(doc.ConsensusParams),
+		})
+	}
+	loader := func() (*tmtypes.GenesisDoc, error) { return doc, nil }
+
+	// Run a chain for a few blocks
+	source := NewMockApp(WithGenesisLoader(loader))
+	source.AddService(&counter.Service{})
+	initChain(source, doc)
+	source.Commit()
+	alice, bob := crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()
+	hashes := make(map[int64][]byte)
+	for height := int64(2); height <= 5; height++ {
+		source.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{ChainID: doc.ChainID, Height: height}})
+		nonce := uint64(height - 2)
+		for _, sk := range []crypto.PrivateKeyEd25519{alice, bob} {
+			tx := signTx(sk, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: uint32(height - 1)}, nonce)
+			assert.Equal(sdk.OK, source.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+		}
+		source.EndBlock(abci.RequestEndBlock{Height: height})
+		hashes[height] = source.Commit().Data
+	}
+
+	// Export the state before the last block
+	exported, err := source.ExportGenesis(4)
+	assert.Nil(err)
+	assert.Equal(int64(5), exported.InitialHeight)
+	assert.Equal(doc.ChainID, exported.ChainID)
+	assert.Equal(doc.Validators, exported.Validators)
+	assert.Equal(hashes[4], []byte(exported.AppHash))
+	// The current genesis doc is left alone
+	assert.Equal(int64(1), doc.InitialHeight)
+	assert.Empty(doc.AppHash)
+
+	// Restarting from the export gives the same state and app hash as the
+	// source chain at the export height
+	restart := func() *MentaApp {
+		app := NewMockApp(WithGenesisLoader(func() (*tmtypes.GenesisDoc, error) { return exported, nil }))
+		app.AddService(&counter.Service{})
+		resp := initChain(app, exported)
+		assert.Len(resp.Validators, 1)
+		assert.Equal(hashes[4], resp.AppHash)
+		assert.Equal(int64(4), app.store.CommitInfo.Version)
+		assert.Equal(hashes[4], app.store.CommitInfo.Hash)
+		return app
+	}
+	restarted := restart()
+	sourceState, err := source.store.SnapshotAt(4)
+	assert.Nil(err)
+	assert.Equal(treeState(sourceState), treeState(restarted.store.Snapshot()))
+
+	// The tree is imported as the version before the initial height
+	assert.Panics(func() {
+		NewMockApp().InitChain(abci.RequestInitChain{ChainId: doc.ChainID, AppStateBytes: exported.AppState})
+	})
+
+	// The new chain carries on from the next height
+	restarted.Commit()
+	assert.Equal(int64(5), restarted.store.CommitInfo.Version)
+
+	// Exporting again gives the same service sections
+	again, err := restarted.ExportGenesis(0)
+	assert.Nil(err)
+	assert.Equal(int64(6), again.InitialHeight)
+	assert.Equal(restarted.store.CommitInfo.Hash, []byte(again.AppHash))
+	assert.Equal(serviceSections(exported.AppState), serviceSections(again.AppState))
+
+	// Without the state tree the services start from their sections, with
+	// a new app hash
+	sections := serviceSections(exported.AppState)
+	withoutTree, err := json.Marshal(sections)
+	assert.Nil(err)
+	fromSections := NewMockApp()
+	fromSections.AddService(&counter.Service{})
+	resp := fromSections.InitChain(abci.RequestInitChain{ChainId: doc.ChainID, InitialHeight: 5, AppStateBytes: withoutTree})
+	assert.Empty(resp.AppHash)
+	fromSections.Commit()
+	assert.Equal(int64(5), fromSections.store.CommitInfo.Version)
+	res := counter.NewQuerySchema(fromSections.store.Snapshot()).GetCountByKey(alice.PubKey().Bytes())
+	assert.Equal(sdk.OK, res.Code)
+	count, err := counter.DecodeCount(res.Data)
+	assert.Nil(err)
+	assert.Equal(uint32(3), count.Current)
+
+	// A service that can't export fails the export, unless it's skipped
+	source.AddService(blockService{name: "noexport"})
+	_, err = source.ExportGenesis(4)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "noexport")
+	_, err = source.ExportGenesis(4, "nope")
+	assert.NotNil(err)
+	// Skipping drops state, so the tree isn't exported
+	skipped, err := source.ExportGenesis(4, "noexport")
+	assert.Nil(err)
+	assert.Empty(skipped.AppHash)
+	skippedSections, err := genesisSections(skipped.AppState)
+	assert.Nil(err)
+	assert.Equal(sections, skippedSections)
+}
+
+// treeState returns every key and value in the state
+func treeState(snapshot storage.TreeReader) map[string]string {
+	state := make(map[string]string)
+	snapshot.IterateKeyRange(nil, nil, true, func(key []byte, value []byte) bool {
+		state[string(key)] = hex.EncodeToString(value)
+		return false
+	})
+	return state
+}
+
+// serviceSections returns the app state sections without the state tree
+func serviceSections(appState json.RawMessage) map[string]json.RawMessage {
+	sections, err := genesisSections(appState)
+	if err != nil {
+		panic(err)
+	}
+	delete(sections, genesisStoreSection)
+	return sections
+}
+
+// panicService writes to the store and then panics
+type panicService struct {
+	blockService
+}
+
+func (srv panicService) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	store.Put([]byte(srv.name), []byte("execute"))
+	var m map[string]int
+	m["boom"]++
+	return sdk.Result{}
+}
+
+func (srv panicService) Check(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	if msgid == 1 {
+		panic("bad check")
+	}
+	return sdk.Result{}
+}
+
+func (srv panicService) BeginBlock(ctx sdk.Context, header tmproto.Header, store sdk.Cache) {
+	store.Put([]byte(srv.name), []byte("begin"))
+	ctx.EventManager().EmitEvent(sdk.NewEvent("begin", sdk.NewAttribute("service", srv.name)))
+	panic("bad begin")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	assert := assert.New(t)
+	calls := []string{}
+	app := NewMockApp(WithLogger(log.NewNopLogger()))
+	app.AddService(panicService{blockService{name: "panic", calls: &calls}})
+	app.AddService(blockService{name: "after", calls: &calls})
+	alice := crypto.GeneratePrivateKey()
+
+	// The hook's writes and events are dropped and the other hooks still run
+	begin := app.BeginBlock(abci.RequestBeginBlock{Header: tmproto.Header{ChainID: "panic", Height: 1}})
+	assert.Equal([]string{"after-begin"}, calls)
+	assert.Equal(1, len(begin.Events))
+
+	check := app.CheckTx(abci.RequestCheckTx{Tx: signTx(alice, "panic", 1, &counter.Increment{}, 0)})
+	assert.Equal(sdk.Panic, check.Code)
+
+	// The service's writes are dropped but the nonce is used
+	tx := signTx(alice, "panic", 0, &counter.Increment{}, 0)
+	deliver := app.DeliverTx(abci.RequestDeliverTx{Tx: tx})
+	assert.Equal(sdk.Panic, deliver.Code)
+	assert.Equal("panic in service 'panic'", deliver.Log)
+	assert.Equal(accounts.ErrBadNonce.Code(), app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+
+	app.EndBlock(abci.RequestEndBlock{Height: 1})
+	app.Commit()
+	assert.Equal(sdk.NotFound, app.Query(abci.RequestQuery{Path: "panic", Data: []byte("panic")}).Code)
+	assert.Equal(sdk.OK, app.Query(abci.RequestQuery{Path: "after", Data: []byte("after")}).Code)
+}
+
+func TestSnapshotDuringCommit(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "menta-snapshot-app")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(InitTendermint(dir))
+
+	// Default pruning keeps the 2 most recent versions
+	app, err := NewApp("snapshots", WithHomeDir(dir), WithSnapshotInterval(5))
+	assert.Nil(err)
+	defer app.store.Close()
+	app.AddService(&counter.Service{})
+
+	alice := crypto.GeneratePrivateKey()
+	tx := signTx(alice, counter.ServiceName, counter.MsgIncrement, &counter.Increment{Value: 1}, 0)
+	assert.Equal(sdk.OK, app.DeliverTx(abci.RequestDeliverTx{Tx: tx}).Code)
+	app.Commit()
+
+	// Commit past the pruning window while the snapshot of height 1 is in progress
+	export, err := app.snapshots.Begin(1)
+	assert.Nil(err)
+	for i := 0; i < 3; i++ {
+		assert.NotPanics(func() { app.Commit() })
+	}
+	assert.Equal([]int64{1, 3, 4}, app.store.Versions())
+
+	info, err := export()
+	assert.Nil(err)
+	assert.Equal(int64(1), info.Height)
+
+	// Released, so height 1 is pruned on the next commit. It also takes
+	// a snapshot in the background
+	app.Commit()
+	assert.Equal([]int64{4, 5}, app.store.Versions())
+	assert.Eventually(func() bool {
+		return len(app.ListSnapshots(abci.RequestListSnapshots{}).Snapshots) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The held snapshot restores
+	target := storage.NewMemStore()
+	restorer := storage.NewSnapshotManager(target, "", 0, 0)
+	assert.Nil(restorer.Restore(*info))
+	for i := uint32(0); i < info.Chunks; i++ {
+		chunk := app.LoadSnapshotChunk(abci.RequestLoadSnapshotChunk{Height: 1, Format: info.Format, Chunk: i}).Chunk
+		_, err := restorer.ApplyChunk(i, chunk)
+		assert.Nil(err)
+	}
+	assert.Equal(int64(1), target.CommitInfo.Version)
+}
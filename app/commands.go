@@ -0,0 +1,100 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/davebryson/menta/storage"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	dbm "github.com/tendermint/tm-db"
+	"github.com/urfave/cli"
+)
+
+// MigrateCommand returns a cli command that copies the state store to a new
+// db with another backend. The node must be stopped. For example:
+//
+//	migrate --to boltdb
+//
+// copies the state to '<home>/data/migrated-boltdb'. To use it, replace
+// '<home>/data/mstate.db' with the copy and set 'db_backend' in the [menta]
+// section of config.toml
+func MigrateCommand(homedir string) cli.Command {
+	return cli.Command{
+		Name:  "migrate",
+		Usage: "Copy the state store to another db backend",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "to", Usage: fmt.Sprintf("backend to copy to, one of %v", storage.Backends)},
+			cli.StringFlag{Name: "out", Usage: "dir for the new db. Defaults to <home>/data/migrated-<backend>"},
+		},
+		Action: func(c *cli.Context) error {
+			config, err := LoadConfig(homedir)
+			if err != nil {
+				return err
+			}
+			mc, err := LoadMentaConfig()
+			if err != nil {
+				return err
+			}
+
+			to := dbm.BackendType(c.String("to"))
+			if err := storage.ValidateBackend(to); err != nil {
+				return err
+			}
+			if to == dbm.MemDBBackend {
+				return fmt.Errorf("%v isn't saved to disk", to)
+			}
+			if to == mc.DBBackend {
+				return fmt.Errorf("the state store already uses %v", to)
+			}
+			out := c.String("out")
+			if out == "" {
+				out = filepath.Join(config.DBDir(), fmt.Sprintf("migrated-%v", to))
+			}
+
+			count, err := storage.MigrateDB(config.DBDir(), mc.DBBackend, out, to)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.App.Writer, "Copied %v keys from %v to %v in %v\n", count, mc.DBBackend, to, out)
+			return nil
+		},
+	}
+}
+
+// ExportCommand returns a cli command that writes a genesis file with the
+// state at a height, to restart the chain from. 'newApp' creates the app
+// with all its services registered. The node must be stopped. For example:
+//
+//	export --height 100 --out genesis.json
+func ExportCommand(newApp func() (*MentaApp, error)) cli.Command {
+	return cli.Command{
+		Name:  "export",
+		Usage: "Export the state to a new genesis file",
+		Flags: []cli.Flag{
+			cli.Int64Flag{Name: "height", Usage: "height of the state to export. Defaults to the latest"},
+			cli.StringFlag{Name: "out", Usage: "file to write the genesis to. Defaults to the command output"},
+			cli.StringSliceFlag{Name: "skip", Usage: "service to leave out of the export, its state is lost. Can be repeated"},
+		},
+		Action: func(c *cli.Context) error {
+			app, err := newApp()
+			if err != nil {
+				return err
+			}
+			defer app.store.Close()
+			genesis, err := app.ExportGenesis(c.Int64("height"), c.StringSlice("skip")...)
+			if err != nil {
+				return err
+			}
+			out := c.String("out")
+			if out == "" {
+				bits, err := tmjson.MarshalIndent(genesis, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(c.App.Writer, string(bits))
+				return nil
+			}
+			return genesis.SaveAs(out)
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/urfave/cli"
+)
+
+func TestExportCommand(t *testing.T) {
+	assert := assert.New(t)
+	doc := &tmtypes.GenesisDoc{
+		ChainID:         "export-cmd",
+		GenesisTime:     time.Unix(1600000000, 0).UTC(),
+		ConsensusParams: tmtypes.DefaultConsensusParams(),
+	}
+	assert.Nil(doc.ValidateAndComplete())
+	newApp := func() (*MentaApp, error) {
+		app := NewMockApp(WithGenesisLoader(func() (*tmtypes.GenesisDoc, error) { return doc, nil }))
+		app.InitChain(abci.RequestInitChain{ChainId: doc.ChainID, Time: doc.GenesisTime})
+		app.Commit()
+		return app, nil
+	}
+
+	// Without --out the genesis goes to the command output
+	var out bytes.Buffer
+	cmd := cli.NewApp()
+	cmd.Writer = &out
+	cmd.Commands = []cli.Command{ExportCommand(newApp)}
+	assert.Nil(cmd.Run([]string{"menta", "export"}))
+
+	var genesis tmtypes.GenesisDoc
+	assert.Nil(tmjson.Unmarshal(out.Bytes(), &genesis))
+	assert.Equal(doc.ChainID, genesis.ChainID)
+	assert.Equal(int64(2), genesis.InitialHeight)
+}
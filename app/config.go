@@ -1,13 +1,17 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/davebryson/menta/storage"
 	"github.com/spf13/viper"
 	cfg "github.com/tendermint/tendermint/config"
 	tmos "github.com/tendermint/tendermint/libs/os"
+	dbm "github.com/tendermint/tm-db"
 )
 
 const (
@@ -15,11 +19,78 @@ const (
 	MENTAHOME = ".menta"
 	// Home is for viper configuration
 	Home = "home"
+
+	// Menta settings are read from the [menta] section of config.toml
+	snapshotIntervalKey   = "menta.snapshot_interval"
+	snapshotKeepRecentKey = "menta.snapshot_keep_recent"
+	pruningKey            = "menta.pruning"
+	pruningKeepRecentKey  = "menta.pruning_keep_recent"
+	pruningKeepEveryKey   = "menta.pruning_keep_every"
+	dbBackendKey          = "menta.db_backend"
+	// Tendermint's own db backend setting
+	tmDBBackendKey = "db_backend"
 )
 
 // DefaultHomeDir for tendermint config
 var DefaultHomeDir = os.ExpandEnv(fmt.Sprintf("$HOME/%s", MENTAHOME))
 
+// ErrMissingHomeDir returned when the home dir doesn't have a config file
+var ErrMissingHomeDir = errors.New("Missing homedir! Did you run the init command?")
+
+// MentaConfig contains settings specific to menta
+type MentaConfig struct {
+	// SnapshotInterval is the number of blocks between state sync snapshots. 0 disables them
+	SnapshotInterval int64
+	// SnapshotKeepRecent is the number of recent snapshots to keep. 0 keeps all
+	SnapshotKeepRecent int
+	// Pruning decides which versions of state the store keeps
+	Pruning storage.PruningOptions
+	// DBBackend of the state store. Defaults to Tendermint's db_backend
+	DBBackend dbm.BackendType
+}
+
+// DefaultMentaConfig has state sync snapshots disabled and keeps
+// the 2 most recent versions of state in goleveldb
+func DefaultMentaConfig() MentaConfig {
+	return MentaConfig{
+		SnapshotInterval:   0,
+		SnapshotKeepRecent: 2,
+		Pruning:            storage.DefaultPruningOptions(),
+		DBBackend:          dbm.GoLevelDBBackend,
+	}
+}
+
+// LoadMentaConfig reads the [menta] section of the config loaded by LoadConfig,
+// using the defaults for anything not set
+func LoadMentaConfig() (MentaConfig, error) {
+	mc := DefaultMentaConfig()
+	if viper.IsSet(snapshotIntervalKey) {
+		mc.SnapshotInterval = viper.GetInt64(snapshotIntervalKey)
+	}
+	if viper.IsSet(snapshotKeepRecentKey) {
+		mc.SnapshotKeepRecent = viper.GetInt(snapshotKeepRecentKey)
+	}
+	pruning, err := storage.NewPruningOptions(
+		viper.GetString(pruningKey),
+		viper.GetInt64(pruningKeepRecentKey),
+		viper.GetInt64(pruningKeepEveryKey),
+	)
+	if err != nil {
+		return mc, err
+	}
+	mc.Pruning = pruning
+
+	if viper.IsSet(dbBackendKey) {
+		mc.DBBackend = dbm.BackendType(viper.GetString(dbBackendKey))
+	} else if viper.IsSet(tmDBBackendKey) {
+		mc.DBBackend = dbm.BackendType(viper.GetString(tmDBBackendKey))
+	}
+	if err := storage.ValidateBackend(mc.DBBackend); err != nil {
+		return mc, err
+	}
+	return mc, nil
+}
+
 // LoadConfig using tendermint config
 func LoadConfig(homedir string) (*cfg.Config, error) {
 	if homedir == "" {
@@ -27,7 +98,7 @@ func LoadConfig(homedir string) (*cfg.Config, error) {
 	}
 
 	if !tmos.FileExists(filepath.Join(homedir, "config", "config.toml")) {
-		return nil, fmt.Errorf("Missing homedir! Did you run the init command?")
+		return nil, ErrMissingHomeDir
 	}
 
 	// Have a config file, load it
@@ -39,7 +110,7 @@ func LoadConfig(homedir string) (*cfg.Config, error) {
 	// I don't think this ever returns an err.  It seems to create a default config if missing
 	err := viper.ReadInConfig()
 	if err != nil {
-		return nil, fmt.Errorf("Missing homedir/config file. Did you run the init command?")
+		return nil, fmt.Errorf("%w: %v", ErrMissingHomeDir, err)
 	}
 
 	config := cfg.DefaultConfig()
@@ -48,7 +119,29 @@ func LoadConfig(homedir string) (*cfg.Config, error) {
 		return nil, err
 	}
 	config.SetRoot(config.RootDir)
-	cfg.EnsureRoot(config.RootDir)
+	if err := ensureRoot(config.RootDir); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
+
+// ensureRoot creates the dirs of the home dir and a default config file if
+// missing. It's cfg.EnsureRoot, which panics, with errors
+func ensureRoot(homedir string) error {
+	for _, dir := range []string{homedir, filepath.Join(homedir, "config"), filepath.Join(homedir, "data")} {
+		if err := tmos.EnsureDir(dir, cfg.DefaultDirPerm); err != nil {
+			return err
+		}
+	}
+	configFile := filepath.Join(homedir, "config", "config.toml")
+	if tmos.FileExists(configFile) {
+		return nil
+	}
+	// WriteConfigFile exits if the write fails. Check it can be written first
+	if err := ioutil.WriteFile(configFile, nil, 0644); err != nil {
+		return err
+	}
+	cfg.WriteConfigFile(configFile, cfg.DefaultConfig())
+	return nil
+}
@@ -1,11 +1,15 @@
 package app
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 const TestConfigDir = "./test_config"
@@ -19,12 +23,52 @@ func TestConfig(t *testing.T) {
 
 	assert := assert.New(t)
 	cfg, err := LoadConfig("./nothere")
-	assert.NotNil(err)
+	assert.True(errors.Is(err, ErrMissingHomeDir))
 	assert.Nil(cfg)
 
-	InitTendermint(TestConfigDir)
-	a := NewApp("ex", TestConfigDir)
+	assert.Nil(InitTendermint(TestConfigDir))
+	a, err := NewApp("ex", WithHomeDir(TestConfigDir))
+	assert.Nil(err)
 	assert.Equal("tcp://127.0.0.1:26658", a.Config.ProxyApp)
 
-	assert.Panics(func() { NewApp("bad", "./bad") })
+	_, err = NewApp("bad", WithHomeDir("./bad"))
+	assert.True(errors.Is(err, ErrMissingHomeDir))
+
+	// Loads the existing private validator
+	assert.Nil(InitTendermint(TestConfigDir))
+	pv, err := loadFilePV(a.Config.PrivValidatorKeyFile(), a.Config.PrivValidatorStateFile())
+	assert.Nil(err)
+	genesis, err := tmtypes.GenesisDocFromFile(a.Config.GenesisFile())
+	assert.Nil(err)
+	assert.Equal(genesis.Validators[0].PubKey, pv.Key.PubKey)
+}
+
+// Bad home dirs and key files return errors rather than panic or exit
+func TestConfigErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "menta-config")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The home dir is a file
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, []byte("x"), 0644))
+	assert.NotNil(InitTendermint(file))
+
+	home := filepath.Join(dir, "home")
+	assert.Nil(InitTendermint(home))
+	a, err := NewApp("corrupt", WithHomeDir(home))
+	assert.Nil(err)
+	defer a.store.Close()
+
+	assert.Nil(ioutil.WriteFile(a.Config.PrivValidatorKeyFile(), []byte("{corrupt"), 0600))
+	assert.NotNil(InitTendermint(home))
+	_, err = a.CreateNode()
+	assert.NotNil(err)
+
+	assert.Nil(os.Remove(a.Config.PrivValidatorKeyFile()))
+	assert.Nil(os.Remove(a.Config.PrivValidatorStateFile()))
+	assert.Nil(os.Mkdir(a.Config.PrivValidatorKeyFile(), 0700))
+	_, err = a.CreateNode()
+	assert.NotNil(err)
 }
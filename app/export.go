@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/davebryson/menta/services/validators"
+	"github.com/davebryson/menta/storage"
+	sdk "github.com/davebryson/menta/types"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tendermint/tendermint/node"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// genesisStoreSection is the app state section with the exported state
+// tree. It's named after the store query path so it can't be a service name
+const genesisStoreSection = storeQueryPath
+
+// ExportGenesis returns a genesis doc with the committed state at 'height',
+// 0 for the latest, to restart the chain from. The app state has a section
+// from every service, and the validators are the current set. The chain-id,
+// consensus params and genesis time are kept from the current genesis doc.
+// The new chain starts at height + 1.
+//
+// The app state also has the state tree, with the version of every node,
+// in the 'store' section. InitChain imports it, so the new chain starts
+// with the app hash at 'height', which is set as the genesis app hash.
+//
+// Every service must implement sdk.Exporter, or the export fails, so no
+// state is lost by accident. Services named in 'skip' are left out and
+// start empty on the new chain. As that changes the state, the tree isn't
+// exported and the new chain starts from the service sections, with a new
+// app hash
+func (app *MentaApp) ExportGenesis(height int64, skip ...string) (*tmtypes.GenesisDoc, error) {
+	current, err := app.loadGenesis()
+	if err != nil {
+		return nil, err
+	}
+	// A copy, as the loader may return the same doc every time
+	genesis := *current
+	snapshot, err := app.store.SnapshotAt(height)
+	if err != nil {
+		return nil, fmt.Errorf("height %v: %w", height, err)
+	}
+	if height == 0 {
+		height = app.store.CommitInfo.Version
+	}
+
+	skipped := make(map[string]bool, len(skip))
+	for _, name := range skip {
+		if _, ok := app.router[name]; !ok {
+			return nil, fmt.Errorf("can't skip unknown service '%v'", name)
+		}
+		skipped[name] = true
+	}
+
+	ctx := sdk.NewContext().WithBlockHeader(tmproto.Header{ChainID: genesis.ChainID, Height: height})
+	appState := make(map[string]json.RawMessage, len(app.services))
+	for _, service := range app.services {
+		if skipped[service.Name()] {
+			app.logger.Info("skipped exporting service", "service", service.Name())
+			continue
+		}
+		exporter, ok := service.(sdk.Exporter)
+		if !ok {
+			return nil, fmt.Errorf("service '%v' can't export its state. Implement sdk.Exporter or skip it", service.Name())
+		}
+		section, err := exporter.Export(ctx, snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("export service '%v': %w", service.Name(), err)
+		}
+		appState[service.Name()] = section
+	}
+	genesis.AppHash = nil
+	if len(skip) == 0 {
+		nodes, hash, err := app.store.ExportState(height)
+		if err != nil {
+			return nil, fmt.Errorf("export state: %w", err)
+		}
+		if appState[genesisStoreSection], err = json.Marshal(nodes); err != nil {
+			return nil, err
+		}
+		genesis.AppHash = hash
+	}
+	genesis.AppState, err = json.Marshal(appState)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := validators.NewQuerySchema(snapshot).Current()
+	if err != nil {
+		return nil, err
+	}
+	genesis.Validators = make([]tmtypes.GenesisValidator, 0, len(set.Validators))
+	for _, val := range set.Validators {
+		pk, err := validatorPubKey(val)
+		if err != nil {
+			return nil, err
+		}
+		genesis.Validators = append(genesis.Validators, tmtypes.GenesisValidator{
+			Address: pk.Address(),
+			PubKey:  pk,
+			Power:   val.Power,
+		})
+	}
+	genesis.InitialHeight = height + 1
+	return &genesis, genesis.ValidateAndComplete()
+}
+
+// importState loads the state tree from the genesis 'store' section as the
+// version before the initial height, so the first block builds on it
+func (app *MentaApp) importState(initialHeight int64, section json.RawMessage) error {
+	if initialHeight < 2 {
+		return fmt.Errorf("the initial height must be more than 1, got %v", initialHeight)
+	}
+	var nodes []byte
+	if err := json.Unmarshal(section, &nodes); err != nil {
+		return err
+	}
+	if err := app.store.ImportState(initialHeight-1, nodes); err != nil {
+		return err
+	}
+	app.cache = storage.NewCache(app.store.Snapshot())
+	app.checkCache = storage.NewCache(app.store.Snapshot())
+	return nil
+}
+
+// loadGenesis loads the current genesis doc with the app's genesis loader
+func (app *MentaApp) loadGenesis() (*tmtypes.GenesisDoc, error) {
+	loader := app.genesis
+	if loader == nil {
+		if app.Config == nil {
+			return nil, ErrMissingHomeDir
+		}
+		loader = node.DefaultGenesisDocProviderFunc(app.Config)
+	}
+	return loader()
+}
+
+func validatorPubKey(val *validators.Validator) (crypto.PubKey, error) {
+	switch val.KeyType {
+	case "", ed25519.KeyType:
+		return ed25519.PubKey(val.PubKey), nil
+	case secp256k1.KeyType:
+		return secp256k1.PubKey(val.PubKey), nil
+	}
+	return nil, fmt.Errorf("unsupported validator key type '%v'", val.KeyType)
+}
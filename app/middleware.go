@@ -0,0 +1,52 @@
+package app
+
+import (
+	"github.com/davebryson/menta/services/accounts"
+	sdk "github.com/davebryson/menta/types"
+)
+
+// signatureMiddleware rejects txs with a bad signature, in both CheckTx and
+// DeliverTx, so a proposer can't include txs that impersonate a sender.
+// Txs verified in CheckTx are added to 'verified' so they aren't verified
+// again when they're rechecked or delivered. Every MentaApp runs it first,
+// sharing its cache with the block batch verification. See WithSigCacheSize
+func signatureMiddleware(verified *sigCache) sdk.Middleware {
+	return func(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool, next sdk.AnteHandler) sdk.Result {
+		hash := ctx.TxHash()
+		if !verified.has(hash) {
+			if !tx.Verify() {
+				return sdk.ResultError(sdk.Unauthorized, "Tx failed validation")
+			}
+			if isCheck {
+				verified.add(hash)
+			}
+		} else if !isCheck {
+			// Delivered txs leave the mempool so they won't be seen again
+			verified.remove(hash)
+		}
+		return next(ctx, tx, store, isCheck)
+	}
+}
+
+// NonceMiddleware rejects txs that don't have the sender's next nonce.
+// In CheckTx the nonce is only used if the rest of the chain accepts the tx.
+// In DeliverTx it's used even if the tx fails so it can't be replayed
+func NonceMiddleware(ctx sdk.Context, tx *sdk.SignedTransaction, store sdk.Cache, isCheck bool, next sdk.AnteHandler) sdk.Result {
+	if result := accounts.CheckNonce(store, tx.Sender, tx.Nonce); result.Code != sdk.OK {
+		return result
+	}
+	if isCheck {
+		result := next(ctx, tx, store, isCheck)
+		if result.Code != sdk.OK {
+			return result
+		}
+		if err := accounts.IncrementNonce(store, tx.Sender); err != nil {
+			return sdk.ResultFromError(err)
+		}
+		return result
+	}
+	if err := accounts.IncrementNonce(store, tx.Sender); err != nil {
+		return sdk.ResultFromError(err)
+	}
+	return next(ctx, tx, store, isCheck)
+}
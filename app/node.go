@@ -8,7 +8,6 @@ import (
 	"github.com/tendermint/tendermint/libs/log"
 	"github.com/tendermint/tendermint/node"
 	"github.com/tendermint/tendermint/p2p"
-	pv "github.com/tendermint/tendermint/privval"
 	"github.com/tendermint/tendermint/proxy"
 )
 
@@ -18,35 +17,52 @@ var (
 )
 
 // CreateNode creates an embedded tendermint node for standalone mode
-func (app *MentaApp) CreateNode() *node.Node {
+func (app *MentaApp) CreateNode() (*node.Node, error) {
+	if app.Config == nil {
+		return nil, ErrMissingHomeDir
+	}
 	// Assumes priv validator has been generated.  See setup()
 	nodeKey, err := p2p.LoadOrGenNodeKey(app.Config.NodeKeyFile())
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	privValidator, err := loadOrGenFilePV(app.Config.PrivValidatorKeyFile(), app.Config.PrivValidatorStateFile())
+	if err != nil {
+		return nil, err
 	}
 
-	node, err := node.NewNode(
+	genesis := app.genesis
+	if genesis == nil {
+		genesis = node.DefaultGenesisDocProviderFunc(app.Config)
+	}
+	n, err := node.NewNode(
 		app.Config,
-		pv.LoadOrGenFilePV(app.Config.PrivValidatorKeyFile(), app.Config.PrivValidatorStateFile()),
+		privValidator,
 		nodeKey,
 		proxy.NewLocalClientCreator(app),
-		node.DefaultGenesisDocProviderFunc(app.Config),
+		genesis,
 		node.DefaultDBProvider,
 		node.DefaultMetricsProvider(app.Config.Instrumentation),
-		logger,
+		app.logger,
 	)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if app.blocks == nil {
+		app.blocks = n.BlockStore()
 	}
-	return node
+	return n, nil
 }
 
-// Run run a standalone / in-process tendermint app
-func (app *MentaApp) Run() {
-	node := app.CreateNode()
-	err := node.Start()
+// Run run a standalone / in-process tendermint app. It only returns
+// if the node fails to start
+func (app *MentaApp) Run() error {
+	node, err := app.CreateNode()
 	if err != nil {
-		logger.Error(err.Error())
+		return err
+	}
+	if err := node.Start(); err != nil {
+		return err
 	}
 	TrapSignal(func() {
 		if node.IsRunning() {
@@ -21,11 +21,13 @@ func TestNodeApp(t *testing.T) {
 		os.RemoveAll(TestDir)
 	}()
 
-	InitTendermint(TestDir)
-	app := NewApp("testapp", TestDir)
+	assert.NoError(t, InitTendermint(TestDir))
+	app, err := NewApp("testapp", WithHomeDir(TestDir))
+	assert.NoError(t, err)
 
-	node := app.CreateNode()
-	err := node.Start()
+	node, err := app.CreateNode()
+	assert.NoError(t, err)
+	err = node.Start()
 	if err != nil {
 		t.Error(err)
 	}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"github.com/davebryson/menta/storage"
+	sdk "github.com/davebryson/menta/types"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/node"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// Option configures a MentaApp in NewApp. Options override the settings
+// in the config file
+type Option func(*options)
+
+type options struct {
+	homedir          string
+	logger           log.Logger
+	backend          dbm.BackendType
+	pruning          *storage.PruningOptions
+	store            *storage.Store
+	middleware       []sdk.Middleware
+	sigCacheSize     *int
+	snapshotInterval *int64
+	genesis          node.GenesisDocProvider
+	blocks           BlockSource
+}
+
+// WithHomeDir loads the Tendermint and menta config from the home dir and
+// keeps state in its data dir. Without it the app has no node config and
+// an in-memory store, which is handy for tests
+func WithHomeDir(homedir string) Option {
+	return func(o *options) { o.homedir = homedir }
+}
+
+// WithLogger sets the logger for the app and its node
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithDBBackend sets the database backend of the state store
+func WithDBBackend(backend dbm.BackendType) Option {
+	return func(o *options) { o.backend = backend }
+}
+
+// WithPruning sets which versions of state the store keeps
+func WithPruning(pruning storage.PruningOptions) Option {
+	return func(o *options) { o.pruning = &pruning }
+}
+
+// WithStore uses the given store instead of opening one. The backend
+// and pruning options are ignored
+func WithStore(store *storage.Store) Option {
+	return func(o *options) { o.store = store }
+}
+
+// WithMiddleware adds middleware that wraps every tx. It runs in order,
+// after menta's signature and nonce checks
+func WithMiddleware(middleware ...sdk.Middleware) Option {
+	return func(o *options) { o.middleware = append(o.middleware, middleware...) }
+}
+
+// WithSigCacheSize sets the number of txs verified in CheckTx that are
+// remembered so their signature isn't verified again when delivered.
+// 0 disables the cache. The default is DefaultSigCacheSize
+func WithSigCacheSize(size int) Option {
+	return func(o *options) { o.sigCacheSize = &size }
+}
+
+// WithSnapshotInterval sets the number of blocks between state sync
+// snapshots. 0 disables them. Snapshots need a home dir
+func WithSnapshotInterval(interval int64) Option {
+	return func(o *options) { o.snapshotInterval = &interval }
+}
+
+// WithGenesisLoader sets how the node loads the genesis doc. The
+// default reads the genesis file in the home dir
+func WithGenesisLoader(loader node.GenesisDocProvider) Option {
+	return func(o *options) { o.genesis = loader }
+}
+
+// WithBlockSource sets where blocks are loaded from to batch verify their
+// txs in BeginBlock. CreateNode uses the node's block store by default
+func WithBlockSource(blocks BlockSource) Option {
+	return func(o *options) { o.blocks = blocks }
+}
@@ -2,10 +2,13 @@ package app
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	cfg "github.com/tendermint/tendermint/config"
+	tmjson "github.com/tendermint/tendermint/libs/json"
 	"github.com/tendermint/tendermint/libs/os"
 	"github.com/tendermint/tendermint/libs/rand"
+	"github.com/tendermint/tendermint/libs/tempfile"
 	"github.com/tendermint/tendermint/p2p"
 	"github.com/tendermint/tendermint/privval"
 	"github.com/tendermint/tendermint/types"
@@ -15,14 +18,11 @@ import (
 var chainIdPrefix = "menta-chain-%v"
 
 // InitTendermint creates the initial configuration information if it doesn't exist
-func InitTendermint(homedir string) {
+func InitTendermint(homedir string) error {
 	if homedir == "" {
 		homedir = DefaultHomeDir
 	}
-
-	if err := createConfig(homedir); err != nil {
-		panic(err)
-	}
+	return createConfig(homedir)
 }
 
 // Code from tendermint init...
@@ -34,19 +34,27 @@ func createConfig(homedir string) error {
 		config.SetRoot(homedir)
 	}
 
-	cfg.EnsureRoot(config.RootDir)
+	if err := ensureRoot(config.RootDir); err != nil {
+		return err
+	}
 
 	// private validator
 	privValKeyFile := config.PrivValidatorKeyFile()
 	privValStateFile := config.PrivValidatorStateFile()
 	var pv *privval.FilePV
 	if os.FileExists(privValKeyFile) {
-		pv = privval.LoadFilePV(privValKeyFile, privValStateFile)
+		loaded, err := loadFilePV(privValKeyFile, privValStateFile)
+		if err != nil {
+			return err
+		}
+		pv = loaded
 		logger.Info("Found private validator", "keyFile", privValKeyFile,
 			"stateFile", privValStateFile)
 	} else {
 		pv = privval.GenFilePV(privValKeyFile, privValStateFile)
-		pv.Save()
+		if err := saveFilePV(pv, privValKeyFile, privValStateFile); err != nil {
+			return err
+		}
 		logger.Info("Generated private validator", "keyFile", privValKeyFile,
 			"stateFile", privValStateFile)
 	}
@@ -71,8 +79,10 @@ func createConfig(homedir string) error {
 			GenesisTime:     tmtime.Now(),
 			ConsensusParams: types.DefaultConsensusParams(),
 		}
-		// TODO: Handle err here
-		key, _ := pv.GetPubKey()
+		key, err := pv.GetPubKey()
+		if err != nil {
+			return err
+		}
 		genDoc.Validators = []types.GenesisValidator{{
 			Address: key.Address(),
 			PubKey:  key,
@@ -86,3 +96,66 @@ func createConfig(homedir string) error {
 	}
 	return nil
 }
+
+// loadOrGenFilePV is privval.LoadOrGenFilePV, which exits the process if a
+// file can't be read or written, with errors
+func loadOrGenFilePV(keyFile, stateFile string) (*privval.FilePV, error) {
+	if os.FileExists(keyFile) {
+		return loadFilePV(keyFile, stateFile)
+	}
+	pv := privval.GenFilePV(keyFile, stateFile)
+	if err := saveFilePV(pv, keyFile, stateFile); err != nil {
+		return nil, err
+	}
+	return pv, nil
+}
+
+// loadFilePV reads the private validator key and last sign state
+func loadFilePV(keyFile, stateFile string) (*privval.FilePV, error) {
+	var key privval.FilePVKey
+	if err := readJSON(keyFile, &key); err != nil {
+		return nil, fmt.Errorf("private validator key: %w", err)
+	}
+	if key.PrivKey == nil {
+		return nil, fmt.Errorf("private validator key: no priv_key in %v", keyFile)
+	}
+	var state privval.FilePVLastSignState
+	if err := readJSON(stateFile, &state); err != nil {
+		return nil, fmt.Errorf("private validator state: %w", err)
+	}
+
+	pv := privval.NewFilePV(key.PrivKey, keyFile, stateFile)
+	pv.LastSignState.Height = state.Height
+	pv.LastSignState.Round = state.Round
+	pv.LastSignState.Step = state.Step
+	pv.LastSignState.Signature = state.Signature
+	pv.LastSignState.SignBytes = state.SignBytes
+	return pv, nil
+}
+
+// saveFilePV writes the private validator key and last sign state
+func saveFilePV(pv *privval.FilePV, keyFile, stateFile string) error {
+	if err := writeJSON(keyFile, pv.Key); err != nil {
+		return err
+	}
+	return writeJSON(stateFile, pv.LastSignState)
+}
+
+func readJSON(path string, v interface{}) error {
+	bits, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := tmjson.Unmarshal(bits, v); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	bits, err := tmjson.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return tempfile.WriteFileAtomic(path, bits, 0600)
+}
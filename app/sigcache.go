@@ -0,0 +1,67 @@
+package app
+
+import "sync"
+
+// DefaultSigCacheSize is the number of verified txs remembered by the
+// signature middleware. It should cover a full mempool. See WithSigCacheSize
+const DefaultSigCacheSize = 10000
+
+// sigCache remembers the hashes of txs with a verified signature so they
+// aren't verified again. The hash is of the raw tx, signature included, so
+// a hit means the exact same bytes were verified. When full, the oldest
+// entry is evicted
+type sigCache struct {
+	mu sync.Mutex
+	// hash to its slot in the ring
+	hashes map[string]int
+	// ring of hashes in the order they were added. Removed hashes leave an
+	// empty slot
+	order []string
+	next  int
+}
+
+func newSigCache(size int) *sigCache {
+	return &sigCache{
+		hashes: make(map[string]int, size),
+		order:  make([]string, size),
+	}
+}
+
+// add a verified tx hash
+func (c *sigCache) add(hash []byte) {
+	if len(c.order) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := string(hash)
+	if _, ok := c.hashes[key]; ok {
+		return
+	}
+	if old := c.order[c.next]; old != "" {
+		delete(c.hashes, old)
+	}
+	c.order[c.next] = key
+	c.hashes[key] = c.next
+	c.next = (c.next + 1) % len(c.order)
+}
+
+// has returns true if the tx hash was verified
+func (c *sigCache) has(hash []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.hashes[string(hash)]
+	return ok
+}
+
+// remove a tx hash. Its slot in the ring is cleared, so it can't evict the
+// hash if it's added again
+func (c *sigCache) remove(hash []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := string(hash)
+	if slot, ok := c.hashes[key]; ok {
+		c.order[slot] = ""
+		delete(c.hashes, key)
+	}
+}
@@ -6,14 +6,17 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/davebryson/menta/services/accounts"
 	sdk "github.com/davebryson/menta/types"
 	rpcclient "github.com/tendermint/tendermint/rpc/client/http"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 )
 
 const rpcAddr = "tcp://localhost:26657"
 
 // SendTx : Send a signed transaction to a local node.
-// Useful for local command line clients
+// Useful for local command line clients. If the tx fails the result is
+// returned along with the error, see TxError
 func SendTx(tx *sdk.SignedTransaction) (string, error) {
 	encodedMsg, err := sdk.EncodeTx(tx)
 	if err != nil {
@@ -30,7 +33,7 @@ func SendTx(tx *sdk.SignedTransaction) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return string(resp), nil
+	return string(resp), TxError(result)
 }
 
 // Query the state of a given service
@@ -40,5 +43,35 @@ func Query(serviceName string, key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := DecodeError(result.Response.Codespace, result.Response.Code, result.Response.Log); err != nil {
+		return nil, err
+	}
 	return result.Response.Value, nil
 }
+
+// NextNonce returns the nonce to use for the next tx from the sender
+func NextNonce(sender []byte) (uint64, error) {
+	value, err := Query(accounts.ServiceName, sender)
+	if err != nil {
+		return 0, err
+	}
+	return accounts.DecodeNonce(value)
+}
+
+// TxError returns the error of a failed tx, from CheckTx or DeliverTx, or nil
+func TxError(result *ctypes.ResultBroadcastTxCommit) error {
+	if err := DecodeError(result.CheckTx.Codespace, result.CheckTx.Code, result.CheckTx.Log); err != nil {
+		return err
+	}
+	return DecodeError(result.DeliverTx.Codespace, result.DeliverTx.Code, result.DeliverTx.Log)
+}
+
+// DecodeError turns the codespace, code and log of an ABCI response back
+// into the registered error, so callers can check it with errors.Is:
+//
+//	if errors.Is(err, counter.ErrBadCount) { ... }
+//
+// The service's package must be imported for its errors to be registered
+func DecodeError(codespace string, code uint32, log string) error {
+	return sdk.ABCIError(codespace, code, log)
+}
@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchSigs are the signed txs of a busy block
+const benchSigs = 300
+
+func benchSignatures(b *testing.B) ([]PublicKeyEd25519, [][]byte, [][]byte) {
+	pubs := make([]PublicKeyEd25519, benchSigs)
+	msgs := make([][]byte, benchSigs)
+	sigs := make([][]byte, benchSigs)
+	for i := range sigs {
+		sk := GeneratePrivateKey()
+		msgs[i] = []byte(fmt.Sprintf("tx %v", i))
+		sig, err := sk.Sign(msgs[i])
+		if err != nil {
+			b.Fatal(err)
+		}
+		pubs[i] = sk.PubKey().(PublicKeyEd25519)
+		sigs[i] = sig
+	}
+	return pubs, msgs, sigs
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	pubs, msgs, sigs := benchSignatures(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		batch := NewBatchVerifier()
+		for i := range sigs {
+			batch.Add(pubs[i], msgs[i], sigs[i])
+		}
+		if ok, _ := batch.Verify(); !ok {
+			b.Fatal("batch failed")
+		}
+	}
+}
+
+// BenchmarkVerifySingle checks the same signatures one by one, to compare
+func BenchmarkVerifySingle(b *testing.B) {
+	pubs, msgs, sigs := benchSignatures(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range sigs {
+			if !pubs[i].Verify(msgs[i], sigs[i]) {
+				b.Fatal("verify failed")
+			}
+		}
+	}
+}
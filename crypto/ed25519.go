@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 
+	voi "github.com/oasisprotocol/curve25519-voi/primitives/ed25519"
 	tmcrypto "github.com/tendermint/tendermint/crypto"
 	"golang.org/x/crypto/ed25519"
 )
@@ -20,6 +21,11 @@ const (
 	SignatureSize = 64
 )
 
+var (
+	_ PrivKey = PrivateKeyEd25519{}
+	_ PubKey  = PublicKeyEd25519{}
+)
+
 // PrivateKeyEd25519 is the private key container
 type PrivateKeyEd25519 [PrivateKeySize]byte
 
@@ -67,13 +73,13 @@ func PrivateKeyFromHex(h string) (PrivateKeyEd25519, error) {
 }
 
 // Sign a message
-func (privKey PrivateKeyEd25519) Sign(msg []byte) []byte {
+func (privKey PrivateKeyEd25519) Sign(msg []byte) ([]byte, error) {
 	signatureBytes := ed25519.Sign(privKey[:], msg)
-	return signatureBytes[:]
+	return signatureBytes[:], nil
 }
 
 // PubKey returns the public key for this private key
-func (privKey PrivateKeyEd25519) PubKey() PublicKeyEd25519 {
+func (privKey PrivateKeyEd25519) PubKey() PubKey {
 	privKeyBytes := [PrivateKeySize]byte(privKey)
 	initialized := false
 	// If the latter 32 bytes of the privkey are all zero, compute the pubkey
@@ -103,6 +109,11 @@ func (privKey PrivateKeyEd25519) ToHex() string {
 	return hex.EncodeToString(privKey[:])
 }
 
+// Type is KeyTypeEd25519
+func (privKey PrivateKeyEd25519) Type() KeyType {
+	return KeyTypeEd25519
+}
+
 // ---- PublicKey ----
 
 func PublicKeyFromBytes(bits []byte) (PublicKeyEd25519, error) {
@@ -130,7 +141,7 @@ func (pubKey PublicKeyEd25519) Verify(msg []byte, sig []byte) bool {
 	if len(sig) != SignatureSize {
 		return false
 	}
-	return ed25519.Verify(pubKey[:], msg, sig)
+	return voi.VerifyWithOptions(pubKey[:], msg, sig, verifyOptions)
 }
 
 // Bytes returns the public key as bytes
@@ -142,3 +153,8 @@ func (pubKey PublicKeyEd25519) Bytes() []byte {
 func (pubKey PublicKeyEd25519) ToHex() string {
 	return hex.EncodeToString(pubKey[:])
 }
+
+// Type is KeyTypeEd25519
+func (pubKey PublicKeyEd25519) Type() KeyType {
+	return KeyTypeEd25519
+}
@@ -15,7 +15,8 @@ func TestBasics(t *testing.T) {
 
 	// Sign and Verify
 	msg := tmcrypto.Sha256([]byte("hello there"))
-	sig := sk.Sign(msg)
+	sig, err := sk.Sign(msg)
+	assert.Nil(err)
 	assert.Equal(64, len(sig))
 	assert.True(pk.Verify(msg, sig))
 
@@ -28,7 +29,83 @@ func TestBasics(t *testing.T) {
 	skhex := sk.ToHex()
 	sk1, err := PrivateKeyFromHex(skhex)
 	assert.Nil(err)
-	sig1 := sk1.Sign(msg)
+	sig1, err := sk1.Sign(msg)
+	assert.Nil(err)
 	assert.Equal(64, len(sig1))
 	assert.True(pk.Verify(msg, sig1))
 }
+
+func TestBatchVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	ok, valid := NewBatchVerifier().Verify()
+	assert.True(ok)
+	assert.Empty(valid)
+
+	// All valid passes the batch equation
+	good := NewBatchVerifier()
+	sk := GeneratePrivateKey()
+	for i := 0; i < 10; i++ {
+		msg := []byte{byte(i)}
+		sig, err := sk.Sign(msg)
+		assert.Nil(err)
+		good.Add(sk.PubKey().(PublicKeyEd25519), msg, sig)
+	}
+	ok, valid = good.Verify()
+	assert.True(ok)
+	assert.Equal(10, len(valid))
+
+	batch := NewBatchVerifier()
+	for i := 0; i < 50; i++ {
+		sk := GeneratePrivateKey()
+		msg := tmcrypto.Sha256([]byte{byte(i)})
+		sig, err := sk.Sign(msg)
+		assert.Nil(err)
+		switch i {
+		case 7:
+			sig[0] ^= 0x01
+		case 31:
+			sig = sig[:10]
+		}
+		batch.Add(sk.PubKey().(PublicKeyEd25519), msg, sig)
+	}
+	assert.Equal(50, batch.Len())
+
+	ok, valid = batch.Verify()
+	assert.False(ok)
+	for i, v := range valid {
+		assert.Equal(i != 7 && i != 31, v)
+	}
+}
+
+func TestSecp256k1(t *testing.T) {
+	assert := assert.New(t)
+
+	sk := GenerateSecp256k1Key()
+	pk := sk.PubKey()
+	assert.Equal(KeyTypeSecp256k1, sk.Type())
+	assert.Equal(KeyTypeSecp256k1, pk.Type())
+	assert.Equal(Secp256k1PublicKeySize, len(pk.Bytes()))
+
+	msg := []byte("hello there")
+	sig, err := sk.Sign(msg)
+	assert.Nil(err)
+	assert.True(pk.Verify(msg, sig))
+	sig[7] ^= byte(0x01)
+	assert.False(pk.Verify(msg, sig))
+
+	// From hex and secret
+	sk1, err := Secp256k1KeyFromHex(sk.ToHex())
+	assert.Nil(err)
+	assert.Equal(sk, sk1)
+	assert.Equal(Secp256k1KeyFromSecret([]byte("a")), Secp256k1KeyFromSecret([]byte("a")))
+
+	// Decoded by key type
+	decoded, err := PubKeyFromBytes(KeyTypeSecp256k1, pk.Bytes())
+	assert.Nil(err)
+	assert.Equal(pk, decoded)
+	_, err = PubKeyFromBytes(KeyTypeEd25519, pk.Bytes())
+	assert.NotNil(err)
+	_, err = PubKeyFromBytes(KeyType(9), pk.Bytes())
+	assert.NotNil(err)
+}
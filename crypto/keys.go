@@ -0,0 +1,64 @@
+package crypto
+
+import "fmt"
+
+// KeyType identifies the signature scheme of a key. It's carried in a tx
+// so the sender's signature is verified with the right scheme
+type KeyType uint32
+
+const (
+	// KeyTypeEd25519 is the default key type
+	KeyTypeEd25519 KeyType = 0
+	// KeyTypeSecp256k1 is used by Bitcoin and Ethereum style wallets
+	KeyTypeSecp256k1 KeyType = 1
+)
+
+func (kt KeyType) String() string {
+	switch kt {
+	case KeyTypeEd25519:
+		return "ed25519"
+	case KeyTypeSecp256k1:
+		return "secp256k1"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(kt))
+}
+
+// PrivKey signs messages
+type PrivKey interface {
+	// Sign a message
+	Sign(msg []byte) ([]byte, error)
+	// PubKey for this private key
+	PubKey() PubKey
+	// Bytes of the private key
+	Bytes() []byte
+	// ToHex returns the private key as a hex value
+	ToHex() string
+	// Type of the key
+	Type() KeyType
+}
+
+// PubKey verifies signatures
+type PubKey interface {
+	// Verify a signature and message
+	Verify(msg []byte, sig []byte) bool
+	// Bytes of the public key
+	Bytes() []byte
+	// ToHex returns the public key as a hex value
+	ToHex() string
+	// Type of the key
+	Type() KeyType
+}
+
+// PubKeyFromBytes decodes a public key of the given type
+func PubKeyFromBytes(keyType KeyType, bits []byte) (PubKey, error) {
+	switch keyType {
+	case KeyTypeEd25519:
+		if len(bits) != PublicKeySize {
+			return nil, fmt.Errorf("publickey: not a valid %v public key size", keyType)
+		}
+		return PublicKeyFromBytes(bits)
+	case KeyTypeSecp256k1:
+		return Secp256k1PublicKeyFromBytes(bits)
+	}
+	return nil, fmt.Errorf("publickey: unknown key type %v", keyType)
+}
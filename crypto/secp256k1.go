@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+const (
+	// Secp256k1PrivateKeySize is the size, in bytes, of secp256k1 private keys
+	Secp256k1PrivateKeySize = 32
+	// Secp256k1PublicKeySize is the size, in bytes, of compressed secp256k1 public keys
+	Secp256k1PublicKeySize = 33
+)
+
+var (
+	_ PrivKey = PrivateKeySecp256k1{}
+	_ PubKey  = PublicKeySecp256k1{}
+)
+
+// PrivateKeySecp256k1 is the secp256k1 private key container
+type PrivateKeySecp256k1 [Secp256k1PrivateKeySize]byte
+
+// PublicKeySecp256k1 is the compressed secp256k1 public key container
+type PublicKeySecp256k1 [Secp256k1PublicKeySize]byte
+
+// GenerateSecp256k1Key generates a new secp256k1 private key
+func GenerateSecp256k1Key() PrivateKeySecp256k1 {
+	var sk PrivateKeySecp256k1
+	copy(sk[:], secp256k1.GenPrivKey())
+	return sk
+}
+
+// Secp256k1KeyFromSecret generates a secp256k1 private key from a given secret
+func Secp256k1KeyFromSecret(secret []byte) PrivateKeySecp256k1 {
+	var sk PrivateKeySecp256k1
+	copy(sk[:], secp256k1.GenPrivKeySecp256k1(secret))
+	return sk
+}
+
+// Secp256k1KeyFromHex decodes a hexified private key into PrivateKeySecp256k1
+func Secp256k1KeyFromHex(h string) (PrivateKeySecp256k1, error) {
+	bits, err := hex.DecodeString(h)
+	if err != nil {
+		return PrivateKeySecp256k1{}, err
+	}
+	if len(bits) != Secp256k1PrivateKeySize {
+		return PrivateKeySecp256k1{}, errors.New("privatekey: not a valid secp256k1 private key size")
+	}
+	var sk PrivateKeySecp256k1
+	copy(sk[:], bits)
+	return sk, nil
+}
+
+// Sign the sha256 hash of the message. The signature is 64 bytes, R || S
+func (privKey PrivateKeySecp256k1) Sign(msg []byte) ([]byte, error) {
+	return secp256k1.PrivKey(privKey[:]).Sign(msg)
+}
+
+// PubKey returns the compressed public key for this private key
+func (privKey PrivateKeySecp256k1) PubKey() PubKey {
+	var pk PublicKeySecp256k1
+	copy(pk[:], secp256k1.PrivKey(privKey[:]).PubKey().Bytes())
+	return pk
+}
+
+// Bytes return the the private key as bytes
+func (privKey PrivateKeySecp256k1) Bytes() []byte {
+	return privKey[:]
+}
+
+// ToHex returns the private key as a hex value
+func (privKey PrivateKeySecp256k1) ToHex() string {
+	return hex.EncodeToString(privKey[:])
+}
+
+// Type is KeyTypeSecp256k1
+func (privKey PrivateKeySecp256k1) Type() KeyType {
+	return KeyTypeSecp256k1
+}
+
+// ---- PublicKey ----
+
+// Secp256k1PublicKeyFromBytes decodes a compressed public key
+func Secp256k1PublicKeyFromBytes(bits []byte) (PublicKeySecp256k1, error) {
+	if len(bits) != Secp256k1PublicKeySize {
+		return PublicKeySecp256k1{}, errors.New("publickey: not a valid secp256k1 public key size")
+	}
+	var pk PublicKeySecp256k1
+	copy(pk[:], bits)
+	return pk, nil
+}
+
+// Verify a signature and message. Only lower-S signatures are accepted
+func (pubKey PublicKeySecp256k1) Verify(msg []byte, sig []byte) bool {
+	return secp256k1.PubKey(pubKey[:]).VerifySignature(msg, sig)
+}
+
+// Bytes returns the public key as bytes
+func (pubKey PublicKeySecp256k1) Bytes() []byte {
+	return pubKey[:]
+}
+
+// ToHex returns the public key as a hex
+func (pubKey PublicKeySecp256k1) ToHex() string {
+	return hex.EncodeToString(pubKey[:])
+}
+
+// Type is KeyTypeSecp256k1
+func (pubKey PublicKeySecp256k1) Type() KeyType {
+	return KeyTypeSecp256k1
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 
 	menta "github.com/davebryson/menta/app"
+	mentaclient "github.com/davebryson/menta/client"
 	"github.com/davebryson/menta/examples/services/counter"
 	rpcclient "github.com/tendermint/tendermint/rpc/client/http"
 	"github.com/urfave/cli"
@@ -21,21 +22,29 @@ const (
 )
 
 // This is the counter application
-func createApp() *menta.MentaApp {
+func createApp() (*menta.MentaApp, error) {
 	// runs tendermint init if needed
-	menta.InitTendermint(homeDir)
+	if err := menta.InitTendermint(homeDir); err != nil {
+		return nil, err
+	}
 	// setup the app
-	app := menta.NewApp("counter-example", homeDir)
+	app, err := menta.NewApp("counter-example", menta.WithHomeDir(homeDir))
+	if err != nil {
+		return nil, err
+	}
 	// Register the service
 	app.AddService(counter.Service{})
 
-	return app
+	return app, nil
 }
 
 // RunApp sets up the menta application and starts the node
-func RunApp() {
-	app := createApp()
-	app.Run()
+func RunApp() error {
+	app, err := createApp()
+	if err != nil {
+		return err
+	}
+	return app.Run()
 }
 
 func queryCounter() {
@@ -57,6 +66,12 @@ func queryCounter() {
 
 func sendTransaction(val uint32) {
 	alice := counter.WalletFromSeed(aliceWallet)
+	nonce, err := mentaclient.NextNonce(alice.PubKey())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	alice.SetNonce(nonce)
 	txbits, err := alice.NewTx(val)
 	if err != nil {
 		fmt.Println(err)
@@ -92,8 +107,7 @@ func main() {
 			Name:  "start",
 			Usage: "Start the tendermint node",
 			Action: func(c *cli.Context) error {
-				RunApp()
-				return nil
+				return RunApp()
 			},
 		},
 		{
@@ -118,6 +132,8 @@ func main() {
 				return nil
 			},
 		},
+		menta.MigrateCommand(homeDir),
+		menta.ExportCommand(createApp),
 	}
 	err := app.Run(os.Args)
 	if err != nil {
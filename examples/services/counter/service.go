@@ -1,14 +1,28 @@
 package counter
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
 	sdk "github.com/davebryson/menta/types"
-	"github.com/gogo/protobuf/proto"
+	proto "github.com/golang/protobuf/proto"
 )
 
 // ServiceName is just that...
 const ServiceName = "counter_example"
 
+// Errors registered under the service's codespace
+var (
+	ErrNotFound = sdk.Register(ServiceName, 1, "count not found")
+	ErrBadCount = sdk.Register(ServiceName, 2, "bad count")
+	ErrEncoding = sdk.Register(ServiceName, 3, "encoding error")
+)
+
 var _ sdk.Service = (*Service)(nil)
+var _ sdk.Validator = (*Service)(nil)
+var _ sdk.Routable = (*Service)(nil)
+var _ sdk.Exporter = (*Service)(nil)
 
 // Service is a simple service to demonstrate
 // the menta API.  It stores a counter for each tx.sender
@@ -17,29 +31,111 @@ type Service struct{}
 // Name is a unique name used to register the service
 func (srv Service) Name() string { return ServiceName }
 
-// Initialize is called on the genesis block.  Not used
-func (srv Service) Initialize(data []byte, store sdk.Cache) {
+// Genesis is the counter section of the genesis app state:
+//
+//	{"counter_example": {"counts": [{"sender": "<hex public key>", "count": 2}, ...]}}
+type Genesis struct {
+	Counts []GenesisCount `json:"counts"`
 }
 
-// Execute runs the core logic for a state transition
-func (srv Service) Execute(sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
-	// Decode the incoming msg in the Tx
-	var msg Increment
-	err := proto.Unmarshal(message, &msg)
+// GenesisCount is the current count of a sender
+type GenesisCount struct {
+	Sender string `json:"sender"`
+	Count  uint32 `json:"count"`
+}
+
+// Initialize is called on the genesis block. Loads the counts, if any
+func (srv Service) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var genesis Genesis
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return err
+	}
+	schema := NewSchema(store)
+	for _, c := range genesis.Counts {
+		sender, err := hex.DecodeString(c.Sender)
+		if err != nil {
+			return err
+		}
+		encoded, err := NewCounter(c.Count).Encode()
+		if err != nil {
+			return err
+		}
+		schema.store.Put(sender, encoded)
+	}
+	return nil
+}
+
+// Export the count of every sender, for a new genesis file
+func (srv Service) Export(ctx sdk.Context, store sdk.Snapshot) ([]byte, error) {
+	genesis := Genesis{Counts: []GenesisCount{}}
+	var err error
+	NewQuerySchema(store).store.IteratePrefix(nil, true, func(key []byte, value []byte) bool {
+		var count *CountValue
+		if count, err = DecodeCount(value); err != nil {
+			return true
+		}
+		genesis.Counts = append(genesis.Counts, GenesisCount{Sender: hex.EncodeToString(key), Count: count.Current})
+		return false
+	})
 	if err != nil {
-		return sdk.ErrorBadTx()
+		return nil, err
 	}
+	return json.Marshal(genesis)
+}
 
-	schema := NewSchema(store)
-	return schema.IncrementCount(sender, msg)
+// MsgIncrement is the msgid of an Increment tx
+const MsgIncrement uint32 = 0
+
+// QueryCount is the name of the typed count query: 'counter_example/count'
+const QueryCount = "count"
+
+// routes decode and dispatch the service's txs and queries
+var routes = sdk.NewRouter().
+	Handle(MsgIncrement, &Increment{}, handleIncrement).
+	HandleQuery(QueryCount, &CountQuery{}, handleCountQuery)
+
+// Routes returns the service's router. Menta uses it instead of Execute
+func (srv Service) Routes() *sdk.Router { return routes }
+
+// Execute runs the core logic for a state transition
+func (srv Service) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	return routes.Execute(ctx, sender, msgid, message, store)
+}
+
+// Check rejects a bad count before it gets to the mempool. It runs the same
+// logic as Execute against the check state so pending txs are accounted for
+func (srv Service) Check(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	return srv.Execute(ctx, sender, msgid, message, store)
 }
 
 // Query committed state for the given used. Key is the public key bytes
-func (srv Service) Query(key []byte, store sdk.Snapshot) sdk.Result {
+func (srv Service) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
 	schema := NewQuerySchema(store)
 	return schema.GetCountByKey(key)
 }
 
+func handleIncrement(ctx sdk.Context, sender []byte, msg proto.Message, store sdk.Cache) sdk.Result {
+	inc := msg.(*Increment)
+	schema := NewSchema(store)
+	result := schema.IncrementCount(sender, *inc)
+	if result.Code == sdk.OK {
+		// Clients can subscribe to: counter_example.sender='<hex public key>'
+		ctx.EventManager().EmitEvent(sdk.NewEvent(ServiceName,
+			sdk.NewAttribute("sender", hex.EncodeToString(sender)),
+			sdk.NewAttribute("count", fmt.Sprint(inc.Value)),
+		))
+	}
+	return result
+}
+
+func handleCountQuery(ctx sdk.Context, req proto.Message, store sdk.Snapshot) sdk.Result {
+	schema := NewQuerySchema(store)
+	return schema.GetCountByKey(req.(*CountQuery).Sender)
+}
+
 // Schema wraps a prefixed store for our service
 type Schema struct {
 	store sdk.PrefixedKVStore
@@ -58,7 +154,7 @@ func (schema Schema) IncrementCount(sender []byte, msg Increment) sdk.Result {
 		// First tx
 		msg, err := NewCounter(1).Encode()
 		if err != nil {
-			return sdk.ResultError(1, "problem encoding new count value")
+			return sdk.ResultFromError(ErrEncoding.Wrap("new count value"))
 		}
 		schema.store.Put(sender, msg)
 		return sdk.Result{}
@@ -67,19 +163,19 @@ func (schema Schema) IncrementCount(sender []byte, msg Increment) sdk.Result {
 	// Decode the current value in the store
 	stateCount, err := DecodeCount(storeVal)
 	if err != nil {
-		return sdk.ResultError(1, "problem decoding stored value")
+		return sdk.ResultFromError(ErrEncoding.Wrapf("stored value: %v", err))
 	}
 
 	// 'tx.msg' should match the expected next state
 	if !stateCount.ValidNextValue(msg.Value) {
-		return sdk.ResultError(2, "bad count")
+		return ErrBadCount.Result()
 	}
 
 	// Increment the count and update storage
 	stateCount.Inc()
 	newcount, err := stateCount.Encode()
 	if err != nil {
-		return sdk.ResultError(1, "problem encoding new count value")
+		return sdk.ResultFromError(ErrEncoding.Wrap("new count value"))
 	}
 
 	// It's good, save it
@@ -105,7 +201,7 @@ func NewQuerySchema(store sdk.Snapshot) QuerySchema {
 func (qs QuerySchema) GetCountByKey(k []byte) sdk.Result {
 	val, err := qs.store.Get(k)
 	if err != nil {
-		return sdk.ResultError(1, err.Error())
+		return sdk.ResultFromError(ErrNotFound.Wrap(err.Error()))
 	}
 	return sdk.Result{
 		Code: 0,
@@ -100,20 +100,62 @@ func (m *CountValue) GetCurrent() uint32 {
 	return 0
 }
 
+// Query
+type CountQuery struct {
+	Sender               []byte   `protobuf:"bytes,1,opt,name=sender,proto3" json:"sender,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CountQuery) Reset()         { *m = CountQuery{} }
+func (m *CountQuery) String() string { return proto.CompactTextString(m) }
+func (*CountQuery) ProtoMessage()    {}
+func (*CountQuery) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d938547f84707355, []int{2}
+}
+
+func (m *CountQuery) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CountQuery.Unmarshal(m, b)
+}
+func (m *CountQuery) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CountQuery.Marshal(b, m, deterministic)
+}
+func (m *CountQuery) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CountQuery.Merge(m, src)
+}
+func (m *CountQuery) XXX_Size() int {
+	return xxx_messageInfo_CountQuery.Size(m)
+}
+func (m *CountQuery) XXX_DiscardUnknown() {
+	xxx_messageInfo_CountQuery.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CountQuery proto.InternalMessageInfo
+
+func (m *CountQuery) GetSender() []byte {
+	if m != nil {
+		return m.Sender
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Increment)(nil), "counter.Increment")
 	proto.RegisterType((*CountValue)(nil), "counter.CountValue")
+	proto.RegisterType((*CountQuery)(nil), "counter.CountQuery")
 }
 
 func init() { proto.RegisterFile("types.proto", fileDescriptor_d938547f84707355) }
 
 var fileDescriptor_d938547f84707355 = []byte{
-	// 106 bytes of a gzipped FileDescriptorProto
+	// 128 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2e, 0xa9, 0x2c, 0x48,
 	0x2d, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x4f, 0xce, 0x2f, 0xcd, 0x2b, 0x49, 0x2d,
 	0x52, 0x52, 0xe4, 0xe2, 0xf4, 0xcc, 0x4b, 0x2e, 0x4a, 0xcd, 0x4d, 0xcd, 0x2b, 0x11, 0x12, 0xe1,
 	0x62, 0x2d, 0x4b, 0xcc, 0x29, 0x4d, 0x95, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0d, 0x82, 0x70, 0x94,
 	0xd4, 0xb8, 0xb8, 0x9c, 0x41, 0xaa, 0xc3, 0x40, 0x3c, 0x21, 0x09, 0x2e, 0xf6, 0xe4, 0xd2, 0xa2,
-	0xa2, 0xd4, 0xbc, 0x12, 0xa8, 0x2a, 0x18, 0x37, 0x89, 0x0d, 0x6c, 0xb4, 0x31, 0x20, 0x00, 0x00,
-	0xff, 0xff, 0x2c, 0xc9, 0xcc, 0xa0, 0x69, 0x00, 0x00, 0x00,
+	0xa2, 0xd4, 0xbc, 0x12, 0xa8, 0x2a, 0x18, 0x57, 0x49, 0x05, 0xaa, 0x2e, 0xb0, 0x34, 0xb5, 0xa8,
+	0x52, 0x48, 0x8c, 0x8b, 0xad, 0x38, 0x35, 0x2f, 0x25, 0xb5, 0x08, 0xac, 0x8c, 0x27, 0x08, 0xca,
+	0x4b, 0x62, 0x03, 0x3b, 0xc0, 0x18, 0x30, 0x00, 0xbd, 0xb0, 0x54, 0x0a, 0x8f, 0x00, 0x00, 0x00,
 }
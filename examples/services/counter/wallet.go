@@ -2,11 +2,13 @@ package counter
 
 import (
 	mcrypto "github.com/davebryson/menta/crypto"
+	"github.com/davebryson/menta/services/accounts"
 	sdk "github.com/davebryson/menta/types"
 )
 
 type Wallet struct {
-	secretKey mcrypto.PrivateKeyEd25519
+	secretKey mcrypto.PrivKey
+	nonce     uint64
 }
 
 func CreateWallet() Wallet {
@@ -22,16 +24,28 @@ func WalletFromSeed(seed string) Wallet {
 
 }
 
-func (wallet Wallet) NewTx(val uint32) ([]byte, error) {
+func (wallet *Wallet) NewTx(val uint32) ([]byte, error) {
 	encoded, err := NewCounter(val).Encode()
 	if err != nil {
 		return nil, err
 	}
-	t := &sdk.SignedTransaction{Service: ServiceName, Msg: encoded}
-	t.Sign(wallet.secretKey)
+	t := &sdk.SignedTransaction{
+		Service:  ServiceName,
+		Msg:      encoded,
+		Nonce:    accounts.EncodeNonce(wallet.nonce),
+		GasLimit: sdk.DefaultGasLimit,
+	}
+	if err := t.Sign(wallet.secretKey); err != nil {
+		return nil, err
+	}
+	wallet.nonce++
 	return sdk.EncodeTx(t)
 }
 
+func (wallet *Wallet) SetNonce(nonce uint64) {
+	wallet.nonce = nonce
+}
+
 func (wallet Wallet) PubKey() []byte {
 	return wallet.secretKey.PubKey().Bytes()
 }
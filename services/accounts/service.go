@@ -0,0 +1,161 @@
+// Package accounts is the built-in account sequence service. It tracks
+// the next expected nonce for each tx sender to prevent replayed transactions.
+package accounts
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	sdk "github.com/davebryson/menta/types"
+)
+
+// ServiceName is the name the service is registered under
+const ServiceName = "accounts"
+
+// NonceSize is the size, in bytes, of an encoded nonce
+const NonceSize = 8
+
+// Errors registered under the service's codespace
+var (
+	ErrBadNonce     = sdk.Register(ServiceName, 1, "bad nonce")
+	ErrCorruptNonce = sdk.Register(ServiceName, 2, "stored nonce is corrupt")
+)
+
+var (
+	_ sdk.Service  = (*Service)(nil)
+	_ sdk.Exporter = (*Service)(nil)
+)
+
+// Service stores the next nonce for each sender. It has no transactions;
+// nonces are checked and incremented by menta for every tx.
+type Service struct{}
+
+// Name of the service
+func (srv Service) Name() string { return ServiceName }
+
+// Genesis is the accounts section of the genesis app state:
+//
+//	{"accounts": {"accounts": [{"sender": "<hex public key>", "nonce": 5}, ...]}}
+//
+// Nonce is the next nonce expected from the sender
+type Genesis struct {
+	Accounts []GenesisAccount `json:"accounts"`
+}
+
+// GenesisAccount is the next nonce of a sender
+type GenesisAccount struct {
+	Sender string `json:"sender"`
+	Nonce  uint64 `json:"nonce"`
+}
+
+// Initialize loads the nonces from the genesis app state
+func (srv Service) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var genesis Genesis
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return err
+	}
+	accounts := sdk.NewPrefixedKVStore(ServiceName, store)
+	for _, acct := range genesis.Accounts {
+		sender, err := hex.DecodeString(acct.Sender)
+		if err != nil {
+			return fmt.Errorf("account %v: %w", acct.Sender, err)
+		}
+		if err := accounts.Put(sender, EncodeNonce(acct.Nonce)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export the next nonce of every sender, sorted by sender
+func (srv Service) Export(ctx sdk.Context, store sdk.Snapshot) ([]byte, error) {
+	genesis := Genesis{Accounts: []GenesisAccount{}}
+	var err error
+	sdk.NewPrefixedSnapshot(ServiceName, store).IteratePrefix(nil, true, func(key []byte, value []byte) bool {
+		var nonce uint64
+		if nonce, err = DecodeNonce(value); err != nil {
+			return true
+		}
+		genesis.Accounts = append(genesis.Accounts, GenesisAccount{Sender: hex.EncodeToString(key), Nonce: nonce})
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(genesis)
+}
+
+// Execute - there are no transactions for this service
+func (srv Service) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	return sdk.ErrorNoHandler()
+}
+
+// Query returns the next expected nonce for the sender. Key is the sender's
+// public key bytes. The nonce is returned encoded, see DecodeNonce
+func (srv Service) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
+	next, err := nextNonce(sdk.NewPrefixedSnapshot(ServiceName, store).Get(key))
+	if err != nil {
+		return sdk.ResultFromError(err)
+	}
+	return sdk.Result{Data: EncodeNonce(next)}
+}
+
+// CheckNonce verifies the tx nonce is the next expected nonce for the sender.
+// Stale or duplicate nonces are rejected.
+func CheckNonce(store sdk.Cache, sender []byte, nonce []byte) sdk.Result {
+	txNonce, err := DecodeNonce(nonce)
+	if err != nil {
+		return sdk.ResultFromError(ErrBadNonce.Wrap(err.Error()))
+	}
+	expected, err := nextNonce(sdk.NewPrefixedKVStore(ServiceName, store).Get(sender))
+	if err != nil {
+		return sdk.ResultFromError(err)
+	}
+	if txNonce != expected {
+		return sdk.ResultFromError(ErrBadNonce.Wrapf("expected %v got %v", expected, txNonce))
+	}
+	return sdk.Result{}
+}
+
+// IncrementNonce marks the sender's current nonce as used. Call this
+// after CheckNonce once the tx is accepted
+func IncrementNonce(store sdk.Cache, sender []byte) error {
+	accounts := sdk.NewPrefixedKVStore(ServiceName, store)
+	current, err := nextNonce(accounts.Get(sender))
+	if err != nil {
+		return err
+	}
+	return accounts.Put(sender, EncodeNonce(current+1))
+}
+
+// EncodeNonce returns the nonce as 8 big endian bytes for tx.Nonce
+func EncodeNonce(nonce uint64) []byte {
+	bits := make([]byte, NonceSize)
+	binary.BigEndian.PutUint64(bits, nonce)
+	return bits
+}
+
+// DecodeNonce is the reverse of EncodeNonce
+func DecodeNonce(bits []byte) (uint64, error) {
+	if len(bits) != NonceSize {
+		return 0, fmt.Errorf("nonce must be %v bytes", NonceSize)
+	}
+	return binary.BigEndian.Uint64(bits), nil
+}
+
+// A sender without a stored nonce starts at 0
+func nextNonce(stored []byte, err error) (uint64, error) {
+	if err != nil {
+		return 0, nil
+	}
+	next, err := DecodeNonce(stored)
+	if err != nil {
+		return 0, ErrCorruptNonce.Wrap(err.Error())
+	}
+	return next, nil
+}
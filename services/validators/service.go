@@ -0,0 +1,455 @@
+// Package validators is the built-in service to manage the validator set.
+// Admins, set in genesis, send signed txs to add, update or remove validators.
+// Updates are staged and returned to Tendermint at the end of the block.
+package validators
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	sdk "github.com/davebryson/menta/types"
+	"github.com/gogo/protobuf/proto"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	cryptoenc "github.com/tendermint/tendermint/crypto/encoding"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+// ServiceName is the name the service is registered under
+const ServiceName = "validators"
+
+// MsgUpdate sets the power of a validator. The tx msg is an encoded Validator.
+// Power 0 removes the validator
+const MsgUpdate uint32 = 1
+
+const (
+	// EventTypeUpdate is emitted for every staged validator update
+	EventTypeUpdate = "validator_update"
+	// AttributeKeyPubKey is the hex encoded public key of the validator
+	AttributeKeyPubKey = "pub_key"
+	// AttributeKeyPower is the new power of the validator
+	AttributeKeyPower = "power"
+)
+
+// Errors registered under the service's codespace
+var (
+	ErrNotAdmin      = sdk.Register(ServiceName, 1, "sender is not a validators admin")
+	ErrNotFound      = sdk.Register(ServiceName, 2, "validator not found")
+	ErrInvalidUpdate = sdk.Register(ServiceName, 3, "invalid validator update")
+	ErrLastValidator = sdk.Register(ServiceName, 4, "can't remove the last validator")
+	ErrCorruptState  = sdk.Register(ServiceName, 5, "validators state is corrupt")
+)
+
+var (
+	currentKey = []byte("current")
+	pendingKey = []byte("pending")
+	adminsKey  = []byte("admins")
+
+	// QuerySet is the query key to return the encoded ValidatorSet.
+	// Any other key is treated as a validator public key
+	QuerySet = []byte("set")
+)
+
+var (
+	_ sdk.Service  = (*Service)(nil)
+	_ sdk.Exporter = (*Service)(nil)
+)
+
+// Service manages the validator set
+type Service struct{}
+
+// Genesis is the validators section of the genesis app state:
+//
+//	{"validators": {
+//	  "admins": ["<hex public key>", ...],
+//	  "validators": [{"pub_key": "<hex public key>", "power": 10, "key_type": "ed25519"}, ...]
+//	}}
+//
+// Validators are optional. If set, they're the initial validator set and
+// replace the validators in the genesis file
+type Genesis struct {
+	Admins     []string           `json:"admins"`
+	Validators []GenesisValidator `json:"validators"`
+}
+
+// GenesisValidator is a validator in the genesis app state
+type GenesisValidator struct {
+	PubKey  string `json:"pub_key"`
+	Power   int64  `json:"power"`
+	KeyType string `json:"key_type"`
+}
+
+// Name of the service
+func (srv Service) Name() string { return ServiceName }
+
+// Initialize loads the admins and validators from the service's section of
+// the genesis app state
+func (srv Service) Initialize(ctx sdk.Context, data []byte, store sdk.Cache) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var genesis Genesis
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return err
+	}
+
+	admins := &Admins{}
+	for _, h := range genesis.Admins {
+		key, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("admin %v: %w", h, err)
+		}
+		admins.Keys = append(admins.Keys, key)
+	}
+	schema := NewSchema(store)
+	schema.saveAdmins(admins)
+
+	set := &ValidatorSet{}
+	for _, val := range genesis.Validators {
+		key, err := hex.DecodeString(val.PubKey)
+		if err != nil {
+			return fmt.Errorf("validator %v: %w", val.PubKey, err)
+		}
+		if val.KeyType == "" {
+			val.KeyType = ed25519.KeyType
+		}
+		if err := validateKey(key, val.KeyType); err != nil {
+			return fmt.Errorf("validator %v: %w", val.PubKey, err)
+		}
+		if val.Power <= 0 {
+			return fmt.Errorf("validator %v: power must be positive", val.PubKey)
+		}
+		set.Validators = append(set.Validators, &Validator{PubKey: key, Power: val.Power, KeyType: val.KeyType})
+	}
+	return schema.save(currentKey, applyUpdates(&ValidatorSet{}, set.Validators))
+}
+
+// Export the admins and the current validator set
+func (srv Service) Export(ctx sdk.Context, store sdk.Snapshot) ([]byte, error) {
+	genesis := Genesis{Admins: []string{}, Validators: []GenesisValidator{}}
+	qs := NewQuerySchema(store)
+	admins, err := qs.admins()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range admins.Keys {
+		genesis.Admins = append(genesis.Admins, hex.EncodeToString(key))
+	}
+	set, err := qs.Current()
+	if err != nil {
+		return nil, err
+	}
+	for _, val := range set.Validators {
+		genesis.Validators = append(genesis.Validators, GenesisValidator{
+			PubKey:  hex.EncodeToString(val.PubKey),
+			Power:   val.Power,
+			KeyType: val.KeyType,
+		})
+	}
+	return json.Marshal(genesis)
+}
+
+// Execute stages a validator update sent by an admin
+func (srv Service) Execute(ctx sdk.Context, sender []byte, msgid uint32, message []byte, store sdk.Cache) sdk.Result {
+	if msgid != MsgUpdate {
+		return sdk.ErrorNoHandler()
+	}
+	var msg Validator
+	if err := proto.Unmarshal(message, &msg); err != nil {
+		return sdk.ResultFromError(ErrInvalidUpdate.Wrap(err.Error()))
+	}
+
+	schema := NewSchema(store)
+	if !schema.IsAdmin(sender) {
+		return ErrNotAdmin.Result()
+	}
+	result := schema.StageUpdate(msg)
+	if result.Code == sdk.OK {
+		ctx.EventManager().EmitEvent(sdk.NewEvent(EventTypeUpdate,
+			sdk.NewAttribute(AttributeKeyPubKey, hex.EncodeToString(msg.PubKey)),
+			sdk.NewAttribute(AttributeKeyPower, fmt.Sprint(msg.Power)),
+		))
+	}
+	return result
+}
+
+// Query the validator set with QuerySet or a single validator by public key
+func (srv Service) Query(ctx sdk.Context, key []byte, store sdk.Snapshot) sdk.Result {
+	schema := NewQuerySchema(store)
+	set, err := schema.Current()
+	if err != nil {
+		return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+	}
+
+	if bytes.Equal(key, QuerySet) {
+		bits, err := proto.Marshal(set)
+		if err != nil {
+			return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+		}
+		return sdk.Result{Data: bits}
+	}
+
+	for _, val := range set.Validators {
+		if bytes.Equal(val.PubKey, key) {
+			bits, err := proto.Marshal(val)
+			if err != nil {
+				return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+			}
+			return sdk.Result{Data: bits}
+		}
+	}
+	return ErrNotFound.Result()
+}
+
+// InitValidators sets up the initial validator set in InitChain, after the
+// services are initialized. If the genesis app state has validators they're
+// returned for ResponseInitChain. Otherwise the validators from the genesis
+// file, in 'updates', are tracked so they can be updated later
+func InitValidators(store sdk.Cache, updates []abci.ValidatorUpdate) ([]abci.ValidatorUpdate, error) {
+	schema := NewSchema(store)
+	current, err := schema.load(currentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(current.Validators) > 0 {
+		initial := make([]abci.ValidatorUpdate, 0, len(current.Validators))
+		for _, val := range current.Validators {
+			initial = append(initial, abci.UpdateValidator(val.PubKey, val.Power, val.KeyType))
+		}
+		return initial, nil
+	}
+
+	set := &ValidatorSet{}
+	for _, update := range updates {
+		pk, err := cryptoenc.PubKeyFromProto(update.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		set.Validators = append(set.Validators, &Validator{
+			PubKey:  pk.Bytes(),
+			Power:   update.Power,
+			KeyType: pk.Type(),
+		})
+	}
+	return nil, schema.save(currentKey, applyUpdates(&ValidatorSet{}, set.Validators))
+}
+
+// EndBlock applies the staged updates to the current set and returns them
+// for ResponseEndBlock
+func EndBlock(store sdk.Cache) ([]abci.ValidatorUpdate, error) {
+	schema := NewSchema(store)
+	pending, err := schema.load(pendingKey)
+	if err != nil || len(pending.Validators) == 0 {
+		return nil, err
+	}
+	current, err := schema.load(currentKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.save(currentKey, applyUpdates(current, pending.Validators)); err != nil {
+		return nil, err
+	}
+	schema.store.Remove(pendingKey)
+
+	updates := make([]abci.ValidatorUpdate, 0, len(pending.Validators))
+	for _, val := range pending.Validators {
+		updates = append(updates, abci.UpdateValidator(val.PubKey, val.Power, val.KeyType))
+	}
+	return updates, nil
+}
+
+// Schema wraps a prefixed store for the service
+type Schema struct {
+	store sdk.PrefixedKVStore
+}
+
+// NewSchema for the given cache
+func NewSchema(store sdk.Cache) Schema {
+	return Schema{
+		store: sdk.NewPrefixedKVStore(ServiceName, store),
+	}
+}
+
+// IsAdmin returns true if the key is a validators admin
+func (schema Schema) IsAdmin(key []byte) bool {
+	bits, err := schema.store.Get(adminsKey)
+	if err != nil {
+		return false
+	}
+	var admins Admins
+	if err := proto.Unmarshal(bits, &admins); err != nil {
+		return false
+	}
+	for _, admin := range admins.Keys {
+		if bytes.Equal(admin, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// StageUpdate validates the update and adds it to the pending updates.
+// A later update for the same validator, in the same block, replaces the earlier one
+func (schema Schema) StageUpdate(update Validator) sdk.Result {
+	if err := validateKey(update.PubKey, update.KeyType); err != nil {
+		return sdk.ResultFromError(ErrInvalidUpdate.Wrap(err.Error()))
+	}
+	if update.Power < 0 {
+		return sdk.ResultFromError(ErrInvalidUpdate.Wrap("power can't be negative"))
+	}
+	if update.KeyType == "" {
+		update.KeyType = ed25519.KeyType
+	}
+
+	current, err := schema.load(currentKey)
+	if err != nil {
+		return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+	}
+	pending, err := schema.load(pendingKey)
+	if err != nil {
+		return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+	}
+
+	staged := &ValidatorSet{}
+	for _, val := range pending.Validators {
+		if !bytes.Equal(val.PubKey, update.PubKey) {
+			staged.Validators = append(staged.Validators, val)
+		}
+	}
+	wasPending := len(staged.Validators) != len(pending.Validators)
+
+	if update.Power == 0 && !contains(current, update.PubKey) {
+		if !wasPending {
+			return ErrNotFound.Result()
+		}
+		// Removing a validator added in this block just cancels the add
+	} else {
+		staged.Validators = append(staged.Validators, &update)
+	}
+
+	if len(applyUpdates(current, staged.Validators).Validators) == 0 {
+		return ErrLastValidator.Result()
+	}
+	if err := schema.save(pendingKey, staged); err != nil {
+		return sdk.ResultFromError(ErrCorruptState.Wrap(err.Error()))
+	}
+	return sdk.Result{}
+}
+
+func (schema Schema) saveAdmins(admins *Admins) {
+	bits, err := proto.Marshal(admins)
+	if err != nil {
+		return
+	}
+	schema.store.Put(adminsKey, bits)
+}
+
+func (schema Schema) load(key []byte) (*ValidatorSet, error) {
+	set := &ValidatorSet{}
+	bits, err := schema.store.Get(key)
+	if err != nil {
+		// Nothing stored yet
+		return set, nil
+	}
+	if err := proto.Unmarshal(bits, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (schema Schema) save(key []byte, set *ValidatorSet) error {
+	bits, err := proto.Marshal(set)
+	if err != nil {
+		return err
+	}
+	return schema.store.Put(key, bits)
+}
+
+// QuerySchema provides a prefixed wrapper to a snapshot of the state store
+type QuerySchema struct {
+	store sdk.PrefixedSnapshot
+}
+
+// NewQuerySchema for the given snapshot
+func NewQuerySchema(store sdk.Snapshot) QuerySchema {
+	return QuerySchema{
+		store: sdk.NewPrefixedSnapshot(ServiceName, store),
+	}
+}
+
+// Current returns the committed validator set
+func (qs QuerySchema) Current() (*ValidatorSet, error) {
+	set := &ValidatorSet{}
+	bits, err := qs.store.Get(currentKey)
+	if err != nil {
+		return set, nil
+	}
+	if err := proto.Unmarshal(bits, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (qs QuerySchema) admins() (*Admins, error) {
+	admins := &Admins{}
+	bits, err := qs.store.Get(adminsKey)
+	if err != nil {
+		return admins, nil
+	}
+	if err := proto.Unmarshal(bits, admins); err != nil {
+		return nil, err
+	}
+	return admins, nil
+}
+
+// applyUpdates returns a new set, sorted by public key, with the updates applied
+func applyUpdates(set *ValidatorSet, updates []*Validator) *ValidatorSet {
+	byKey := make(map[string]*Validator, len(set.Validators))
+	for _, val := range set.Validators {
+		byKey[string(val.PubKey)] = val
+	}
+	for _, update := range updates {
+		if update.Power == 0 {
+			delete(byKey, string(update.PubKey))
+			continue
+		}
+		byKey[string(update.PubKey)] = update
+	}
+
+	next := &ValidatorSet{Validators: make([]*Validator, 0, len(byKey))}
+	for _, val := range byKey {
+		next.Validators = append(next.Validators, val)
+	}
+	sort.Slice(next.Validators, func(i, j int) bool {
+		return bytes.Compare(next.Validators[i].PubKey, next.Validators[j].PubKey) < 0
+	})
+	return next
+}
+
+func contains(set *ValidatorSet, key []byte) bool {
+	for _, val := range set.Validators {
+		if bytes.Equal(val.PubKey, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateKey(key []byte, keyType string) error {
+	switch keyType {
+	case "", ed25519.KeyType:
+		if len(key) != ed25519.PubKeySize {
+			return fmt.Errorf("ed25519 public key must be %v bytes", ed25519.PubKeySize)
+		}
+	case secp256k1.KeyType:
+		if len(key) != secp256k1.PubKeySize {
+			return fmt.Errorf("secp256k1 public key must be %v bytes", secp256k1.PubKeySize)
+		}
+	default:
+		return fmt.Errorf("unsupported key type '%v'", keyType)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: validators.proto
+
+package validators
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Message & storage: a validator and its voting power.
+// As a message, power 0 removes the validator
+type Validator struct {
+	PubKey               []byte   `protobuf:"bytes,1,opt,name=pub_key,json=pubKey,proto3" json:"pub_key,omitempty"`
+	Power                int64    `protobuf:"varint,2,opt,name=power,proto3" json:"power,omitempty"`
+	KeyType              string   `protobuf:"bytes,3,opt,name=key_type,json=keyType,proto3" json:"key_type,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Validator) Reset()         { *m = Validator{} }
+func (m *Validator) String() string { return proto.CompactTextString(m) }
+func (*Validator) ProtoMessage()    {}
+func (*Validator) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7c1faa28db155a92, []int{0}
+}
+
+func (m *Validator) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Validator.Unmarshal(m, b)
+}
+func (m *Validator) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Validator.Marshal(b, m, deterministic)
+}
+func (m *Validator) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Validator.Merge(m, src)
+}
+func (m *Validator) XXX_Size() int {
+	return xxx_messageInfo_Validator.Size(m)
+}
+func (m *Validator) XXX_DiscardUnknown() {
+	xxx_messageInfo_Validator.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Validator proto.InternalMessageInfo
+
+func (m *Validator) GetPubKey() []byte {
+	if m != nil {
+		return m.PubKey
+	}
+	return nil
+}
+
+func (m *Validator) GetPower() int64 {
+	if m != nil {
+		return m.Power
+	}
+	return 0
+}
+
+func (m *Validator) GetKeyType() string {
+	if m != nil {
+		return m.KeyType
+	}
+	return ""
+}
+
+// Storage: a set of validators sorted by public key
+type ValidatorSet struct {
+	Validators           []*Validator `protobuf:"bytes,1,rep,name=validators,proto3" json:"validators,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ValidatorSet) Reset()         { *m = ValidatorSet{} }
+func (m *ValidatorSet) String() string { return proto.CompactTextString(m) }
+func (*ValidatorSet) ProtoMessage()    {}
+func (*ValidatorSet) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7c1faa28db155a92, []int{1}
+}
+
+func (m *ValidatorSet) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ValidatorSet.Unmarshal(m, b)
+}
+func (m *ValidatorSet) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ValidatorSet.Marshal(b, m, deterministic)
+}
+func (m *ValidatorSet) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidatorSet.Merge(m, src)
+}
+func (m *ValidatorSet) XXX_Size() int {
+	return xxx_messageInfo_ValidatorSet.Size(m)
+}
+func (m *ValidatorSet) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidatorSet.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidatorSet proto.InternalMessageInfo
+
+func (m *ValidatorSet) GetValidators() []*Validator {
+	if m != nil {
+		return m.Validators
+	}
+	return nil
+}
+
+// Storage: public keys of the accounts allowed to update validators
+type Admins struct {
+	Keys                 [][]byte `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Admins) Reset()         { *m = Admins{} }
+func (m *Admins) String() string { return proto.CompactTextString(m) }
+func (*Admins) ProtoMessage()    {}
+func (*Admins) Descriptor() ([]byte, []int) {
+	return fileDescriptor_7c1faa28db155a92, []int{2}
+}
+
+func (m *Admins) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Admins.Unmarshal(m, b)
+}
+func (m *Admins) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Admins.Marshal(b, m, deterministic)
+}
+func (m *Admins) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Admins.Merge(m, src)
+}
+func (m *Admins) XXX_Size() int {
+	return xxx_messageInfo_Admins.Size(m)
+}
+func (m *Admins) XXX_DiscardUnknown() {
+	xxx_messageInfo_Admins.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Admins proto.InternalMessageInfo
+
+func (m *Admins) GetKeys() [][]byte {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Validator)(nil), "validators.Validator")
+	proto.RegisterType((*ValidatorSet)(nil), "validators.ValidatorSet")
+	proto.RegisterType((*Admins)(nil), "validators.Admins")
+}
+
+func init() { proto.RegisterFile("validators.proto", fileDescriptor_7c1faa28db155a92) }
+
+var fileDescriptor_7c1faa28db155a92 = []byte{
+	// 177 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x28, 0x4b, 0xcc, 0xc9,
+	0x4c, 0x49, 0x2c, 0xc9, 0x2f, 0x2a, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0xe2, 0x42, 0x88,
+	0x28, 0x85, 0x72, 0x71, 0x86, 0xc1, 0x78, 0x42, 0xe2, 0x5c, 0xec, 0x05, 0xa5, 0x49, 0xf1, 0xd9,
+	0xa9, 0x95, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x3c, 0x41, 0x6c, 0x05, 0xa5, 0x49, 0xde, 0xa9, 0x95,
+	0x42, 0x22, 0x5c, 0xac, 0x05, 0xf9, 0xe5, 0xa9, 0x45, 0x12, 0x4c, 0x0a, 0x8c, 0x1a, 0xcc, 0x41,
+	0x10, 0x8e, 0x90, 0x24, 0x17, 0x47, 0x76, 0x6a, 0x65, 0x7c, 0x49, 0x65, 0x41, 0xaa, 0x04, 0xb3,
+	0x02, 0xa3, 0x06, 0x67, 0x10, 0x7b, 0x76, 0x6a, 0x65, 0x48, 0x65, 0x41, 0xaa, 0x92, 0x2b, 0x17,
+	0x0f, 0xdc, 0xd8, 0xe0, 0xd4, 0x12, 0x21, 0x53, 0x2e, 0x24, 0x4b, 0x25, 0x18, 0x15, 0x98, 0x35,
+	0xb8, 0x8d, 0x44, 0xf5, 0x90, 0x5c, 0x06, 0x57, 0x1d, 0x84, 0xec, 0x3a, 0x19, 0x2e, 0x36, 0xc7,
+	0x94, 0xdc, 0xcc, 0xbc, 0x62, 0x21, 0x21, 0x2e, 0x96, 0xec, 0xd4, 0x4a, 0x88, 0x56, 0x9e, 0x20,
+	0x30, 0x3b, 0x89, 0x0d, 0xec, 0x1d, 0x63, 0xc0, 0x00, 0xaf, 0xac, 0x73, 0xbf, 0xe2, 0x00, 0x00,
+	0x00,
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+
+	dbm "github.com/tendermint/tm-db"
+)
+
+// copyBatchSize is the number of writes per batch when migrating a db
+const copyBatchSize = 10000
+
+// Backends compiled into this build. Only goleveldb and memdb are in by
+// default; the others are added with the same build tag tm-db uses for
+// them, e.g. 'go build -tags boltdb'
+var Backends = []dbm.BackendType{
+	dbm.GoLevelDBBackend,
+	dbm.MemDBBackend,
+}
+
+// ValidateBackend returns an error if the backend isn't one of Backends
+func ValidateBackend(backend dbm.BackendType) error {
+	for _, b := range Backends {
+		if b == backend {
+			return nil
+		}
+	}
+	return fmt.Errorf("Store: unknown db backend '%v', expected one of %v", backend, Backends)
+}
+
+// MigrateDB copies all the state in 'srcDir' to a new db, using another backend,
+// in 'dstDir'. The destination must be empty. Returns the number of keys copied
+func MigrateDB(srcDir string, srcBackend dbm.BackendType, dstDir string, dstBackend dbm.BackendType) (int64, error) {
+	src, err := loadDb(srcDir, srcBackend)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := loadDb(dstDir, dstBackend)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	empty, err := isEmpty(dst)
+	if err != nil {
+		return 0, err
+	}
+	if !empty {
+		return 0, fmt.Errorf("Store: the destination db in '%v' isn't empty", dstDir)
+	}
+
+	iter, err := src.Iterator(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var count int64
+	batch := dst.NewBatch()
+	for ; iter.Valid(); iter.Next() {
+		if err := batch.Set(iter.Key(), iter.Value()); err != nil {
+			batch.Close()
+			return count, err
+		}
+		count++
+		if count%copyBatchSize == 0 {
+			if err := writeBatch(batch); err != nil {
+				return count, err
+			}
+			batch = dst.NewBatch()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		batch.Close()
+		return count, err
+	}
+	return count, writeBatch(batch)
+}
+
+func writeBatch(batch dbm.Batch) error {
+	defer batch.Close()
+	return batch.WriteSync()
+}
+
+func isEmpty(db dbm.DB) (bool, error) {
+	iter, err := db.Iterator(nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+	return !iter.Valid(), nil
+}
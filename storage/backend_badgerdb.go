@@ -0,0 +1,10 @@
+//go:build badgerdb
+// +build badgerdb
+
+package storage
+
+import dbm "github.com/tendermint/tm-db"
+
+func init() {
+	Backends = append(Backends, dbm.BadgerDBBackend)
+}
@@ -0,0 +1,10 @@
+//go:build cleveldb
+// +build cleveldb
+
+package storage
+
+import dbm "github.com/tendermint/tm-db"
+
+func init() {
+	Backends = append(Backends, dbm.CLevelDBBackend)
+}
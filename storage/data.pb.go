@@ -68,19 +68,208 @@ func (m *CommitData) GetVersion() int64 {
 	return 0
 }
 
+// Exported IAVL node. Snapshot chunks are a stream of
+// length-prefixed nodes in the order given by the iavl exporter
+type SnapshotNode struct {
+	Key                  []byte   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value                []byte   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Version              int64    `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	Height               int32    `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotNode) Reset()         { *m = SnapshotNode{} }
+func (m *SnapshotNode) String() string { return proto.CompactTextString(m) }
+func (*SnapshotNode) ProtoMessage()    {}
+func (*SnapshotNode) Descriptor() ([]byte, []int) {
+	return fileDescriptor_871986018790d2fd, []int{1}
+}
+
+func (m *SnapshotNode) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotNode.Unmarshal(m, b)
+}
+func (m *SnapshotNode) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotNode.Marshal(b, m, deterministic)
+}
+func (m *SnapshotNode) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotNode.Merge(m, src)
+}
+func (m *SnapshotNode) XXX_Size() int {
+	return xxx_messageInfo_SnapshotNode.Size(m)
+}
+func (m *SnapshotNode) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotNode.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotNode proto.InternalMessageInfo
+
+func (m *SnapshotNode) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *SnapshotNode) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *SnapshotNode) GetVersion() int64 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *SnapshotNode) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+// State sync snapshot metadata: the hash of each chunk in order
+type SnapshotMetadata struct {
+	ChunkHashes          [][]byte `protobuf:"bytes,1,rep,name=chunk_hashes,json=chunkHashes,proto3" json:"chunk_hashes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotMetadata) Reset()         { *m = SnapshotMetadata{} }
+func (m *SnapshotMetadata) String() string { return proto.CompactTextString(m) }
+func (*SnapshotMetadata) ProtoMessage()    {}
+func (*SnapshotMetadata) Descriptor() ([]byte, []int) {
+	return fileDescriptor_871986018790d2fd, []int{2}
+}
+
+func (m *SnapshotMetadata) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotMetadata.Unmarshal(m, b)
+}
+func (m *SnapshotMetadata) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotMetadata.Marshal(b, m, deterministic)
+}
+func (m *SnapshotMetadata) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotMetadata.Merge(m, src)
+}
+func (m *SnapshotMetadata) XXX_Size() int {
+	return xxx_messageInfo_SnapshotMetadata.Size(m)
+}
+func (m *SnapshotMetadata) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotMetadata.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotMetadata proto.InternalMessageInfo
+
+func (m *SnapshotMetadata) GetChunkHashes() [][]byte {
+	if m != nil {
+		return m.ChunkHashes
+	}
+	return nil
+}
+
+// Snapshot information stored on disk alongside the chunks
+type SnapshotInfo struct {
+	Height               int64    `protobuf:"varint,1,opt,name=height,proto3" json:"height,omitempty"`
+	Format               uint32   `protobuf:"varint,2,opt,name=format,proto3" json:"format,omitempty"`
+	Chunks               uint32   `protobuf:"varint,3,opt,name=chunks,proto3" json:"chunks,omitempty"`
+	Hash                 []byte   `protobuf:"bytes,4,opt,name=hash,proto3" json:"hash,omitempty"`
+	Metadata             []byte   `protobuf:"bytes,5,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotInfo) Reset()         { *m = SnapshotInfo{} }
+func (m *SnapshotInfo) String() string { return proto.CompactTextString(m) }
+func (*SnapshotInfo) ProtoMessage()    {}
+func (*SnapshotInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_871986018790d2fd, []int{3}
+}
+
+func (m *SnapshotInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotInfo.Unmarshal(m, b)
+}
+func (m *SnapshotInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotInfo.Marshal(b, m, deterministic)
+}
+func (m *SnapshotInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotInfo.Merge(m, src)
+}
+func (m *SnapshotInfo) XXX_Size() int {
+	return xxx_messageInfo_SnapshotInfo.Size(m)
+}
+func (m *SnapshotInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotInfo proto.InternalMessageInfo
+
+func (m *SnapshotInfo) GetHeight() int64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetFormat() uint32 {
+	if m != nil {
+		return m.Format
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetChunks() uint32 {
+	if m != nil {
+		return m.Chunks
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *SnapshotInfo) GetMetadata() []byte {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*CommitData)(nil), "storage.CommitData")
+	proto.RegisterType((*SnapshotNode)(nil), "storage.SnapshotNode")
+	proto.RegisterType((*SnapshotMetadata)(nil), "storage.SnapshotMetadata")
+	proto.RegisterType((*SnapshotInfo)(nil), "storage.SnapshotInfo")
 }
 
 func init() { proto.RegisterFile("data.proto", fileDescriptor_871986018790d2fd) }
 
 var fileDescriptor_871986018790d2fd = []byte{
-	// 101 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4a, 0x49, 0x2c, 0x49,
-	0xd4, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2f, 0x2e, 0xc9, 0x2f, 0x4a, 0x4c, 0x4f, 0x55,
-	0xb2, 0xe2, 0xe2, 0x72, 0xce, 0xcf, 0xcd, 0xcd, 0x2c, 0x71, 0x49, 0x2c, 0x49, 0x14, 0x12, 0xe2,
-	0x62, 0xc9, 0x48, 0x2c, 0xce, 0x90, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x09, 0x02, 0xb3, 0x85, 0x24,
-	0xb8, 0xd8, 0xcb, 0x52, 0x8b, 0x8a, 0x33, 0xf3, 0xf3, 0x24, 0x98, 0x14, 0x18, 0x35, 0x98, 0x83,
-	0x60, 0xdc, 0x24, 0x36, 0xb0, 0x59, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x59, 0x19, 0x96,
-	0x24, 0x59, 0x00, 0x00, 0x00,
+	// 250 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x90, 0x31, 0x4f, 0xc3, 0x30,
+	0x10, 0x85, 0x65, 0xd2, 0xb4, 0xe8, 0x70, 0xa5, 0xca, 0x42, 0xc8, 0x62, 0x0a, 0x99, 0x32, 0xb1,
+	0x20, 0x16, 0x56, 0x18, 0x60, 0x80, 0xc1, 0xfc, 0x00, 0x74, 0x50, 0xb7, 0x8e, 0x4a, 0x72, 0x55,
+	0x7c, 0xad, 0xc4, 0x1f, 0xe0, 0x77, 0x23, 0x1f, 0x6e, 0x09, 0xdb, 0x7d, 0x4f, 0xba, 0x77, 0xef,
+	0x1e, 0xc0, 0x12, 0x19, 0xaf, 0xb7, 0x03, 0x31, 0x99, 0x59, 0x64, 0x1a, 0x70, 0xed, 0xeb, 0x3b,
+	0x80, 0x7b, 0xea, 0xba, 0x96, 0x1f, 0x90, 0xd1, 0x18, 0x98, 0x04, 0x8c, 0xc1, 0xaa, 0x4a, 0x35,
+	0xda, 0xc9, 0x6c, 0x2c, 0xcc, 0xf6, 0x7e, 0x88, 0x2d, 0xf5, 0xf6, 0xa4, 0x52, 0x4d, 0xe1, 0x0e,
+	0x58, 0x07, 0xd0, 0xaf, 0x3d, 0x6e, 0x63, 0x20, 0x7e, 0xa1, 0xa5, 0x37, 0x0b, 0x28, 0x36, 0xfe,
+	0x2b, 0x2f, 0xa7, 0xd1, 0x9c, 0x43, 0xb9, 0xc7, 0xcf, 0x9d, 0x97, 0x4d, 0xed, 0x7e, 0x61, 0xec,
+	0x58, 0xfc, 0x73, 0x34, 0x17, 0x30, 0x0d, 0xbe, 0x5d, 0x07, 0xb6, 0x93, 0x4a, 0x35, 0xa5, 0xcb,
+	0x54, 0xdf, 0xc2, 0xe2, 0x70, 0xe9, 0xd9, 0x33, 0xa6, 0x47, 0xcc, 0x15, 0xe8, 0x8f, 0xb0, 0xeb,
+	0x37, 0x6f, 0x29, 0xa5, 0x8f, 0x56, 0x55, 0x45, 0xa3, 0xdd, 0x99, 0x68, 0x8f, 0x22, 0xd5, 0xdf,
+	0xea, 0x2f, 0xe1, 0x53, 0xbf, 0xa2, 0x91, 0xbf, 0x92, 0xc3, 0x99, 0x92, 0xbe, 0xa2, 0xa1, 0x43,
+	0x96, 0xa0, 0x73, 0x97, 0x29, 0xe9, 0xe2, 0x17, 0x25, 0xe8, 0xdc, 0x65, 0x3a, 0xf6, 0x34, 0x19,
+	0xf5, 0x74, 0x09, 0xa7, 0x5d, 0xce, 0x66, 0x4b, 0xd1, 0x8f, 0xfc, 0x3e, 0x95, 0xd6, 0x6f, 0x7e,
+	0x06, 0x00, 0x8e, 0x6f, 0xff, 0xb3, 0x83, 0x01, 0x00, 0x00,
 }
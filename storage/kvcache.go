@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"bytes"
+	"sort"
+)
+
 var _ Cache = (*KVCache)(nil)
 
 // CacheOp operation (make this private)
@@ -13,6 +18,8 @@ type CacheOp struct {
 type KVCache struct {
 	snapshot TreeReader
 	storage  map[string]CacheOp
+	// set on a branch. Reads fall through to the parent instead of the snapshot
+	parent Cache
 }
 
 // NewCache return a fresh empty cache with ref to the State Store
@@ -23,6 +30,46 @@ func NewCache(snap TreeReader) *KVCache {
 	}
 }
 
+// Branch returns a nested cache layered on this one. Changes made to the
+// branch are only visible to this cache after calling Write on the branch.
+// Used to discard the writes of a failed tx
+func (cache *KVCache) Branch() *KVCache {
+	return NewBranch(cache)
+}
+
+// NewBranch returns a cache layered on any Cache, like Branch. Write puts
+// the changes to the parent with its Put and Remove
+func NewBranch(parent Cache) *KVCache {
+	return &KVCache{
+		storage: make(map[string]CacheOp),
+		parent:  parent,
+	}
+}
+
+// Write merges the changes in a branch into its parent
+func (cache *KVCache) Write() {
+	if cache.parent == nil {
+		return
+	}
+	// Sort keys so the parent is updated in the same order on every node
+	keys := make([]string, 0, len(cache.storage))
+	for key := range cache.storage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		op := cache.storage[key]
+		switch {
+		case op.delete:
+			cache.parent.Remove([]byte(key))
+		case op.dirty:
+			cache.parent.Put([]byte(key), op.value)
+		}
+	}
+	cache.storage = make(map[string]CacheOp)
+}
+
 // Put a key in the cache
 func (cache *KVCache) Put(key, val []byte) {
 	cache.storage[string(key)] = CacheOp{val, true, false}
@@ -50,12 +97,21 @@ func (cache *KVCache) Get(key []byte) ([]byte, error) {
 
 	// check the cache
 	data, ok := cache.storage[cacheKey]
-	if ok && !data.delete {
+	if ok {
+		if data.delete {
+			return nil, ErrValueNotFound
+		}
 		return data.value, nil
 	}
 
-	// Not in the cache, go to cold storage
-	value, err := cache.snapshot.Get(key)
+	// Not in the cache, go to the parent or cold storage
+	var value []byte
+	var err error
+	if cache.parent != nil {
+		value, err = cache.parent.Get(key)
+	} else {
+		value, err = cache.snapshot.Get(key)
+	}
 	if err == nil {
 		// cache it as not-dirty
 		cache.storage[cacheKey] = CacheOp{value, false, false}
@@ -65,7 +121,82 @@ func (cache *KVCache) Get(key []byte) ([]byte, error) {
 	return nil, ErrValueNotFound
 }
 
+// IterateKeyRange over [start, end) in sorted key order. Pending writes and
+// deletes in the cache (and its parents, for a branch) are merged with the
+// committed state. A nil end iterates to the last key. 'fn' returns true to stop
+func (cache *KVCache) IterateKeyRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	// Pending changes in the range, in iteration order. Entries that aren't
+	// dirty or deleted are just cached reads of the underlying state
+	pending := make([]string, 0)
+	for key, op := range cache.storage {
+		if (op.dirty || op.delete) && inRange([]byte(key), start, end) {
+			pending = append(pending, key)
+		}
+	}
+	sort.Strings(pending)
+	if !ascending {
+		for i, j := 0, len(pending)-1; i < j; i, j = i+1, j-1 {
+			pending[i], pending[j] = pending[j], pending[i]
+		}
+	}
+
+	// before returns true if pending key 'a' comes before 'b' in iteration order
+	before := func(a, b string) bool {
+		if ascending {
+			return a < b
+		}
+		return a > b
+	}
+	// emit pending keys before 'key', or all remaining if key is nil
+	next := 0
+	emitPending := func(key []byte) bool {
+		for ; next < len(pending); next++ {
+			if key != nil && !before(pending[next], string(key)) {
+				return false
+			}
+			op := cache.storage[pending[next]]
+			if op.delete {
+				continue
+			}
+			if fn([]byte(pending[next]), op.value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var iterate func(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool
+	if cache.parent != nil {
+		iterate = cache.parent.IterateKeyRange
+	} else {
+		iterate = cache.snapshot.IterateKeyRange
+	}
+	stopped := iterate(start, end, ascending, func(key []byte, value []byte) bool {
+		if emitPending(key) {
+			return true
+		}
+		// Pending change to the same key replaces the underlying value
+		if next < len(pending) && pending[next] == string(key) {
+			op := cache.storage[pending[next]]
+			next++
+			if op.delete {
+				return false
+			}
+			return fn(key, op.value)
+		}
+		return fn(key, value)
+	})
+	if stopped {
+		return true
+	}
+	return emitPending(nil)
+}
+
 // ToBatch returns the cached entries
 func (cache *KVCache) ToBatch() map[string]CacheOp {
 	return cache.storage
 }
+
+func inRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (end == nil || bytes.Compare(key, end) < 0)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+)
+
+const (
+	// PruningDefault keeps the 2 most recent versions
+	PruningDefault = "default"
+	// PruningNothing keeps every version
+	PruningNothing = "nothing"
+	// PruningCustom uses the given keep recent and keep every values
+	PruningCustom = "custom"
+)
+
+// PruningOptions decide which versions of state the store keeps after a Commit.
+// Older versions are needed for historical queries and state sync snapshots
+type PruningOptions struct {
+	// KeepRecent is the number of most recent versions to keep. 0 keeps every version
+	KeepRecent int64
+	// KeepEvery keeps every Nth version forever, in addition to the recent ones. 0 disables it
+	KeepEvery int64
+}
+
+// NewPruningOptions returns the options for a strategy. 'keepRecent' and
+// 'keepEvery' are only used by PruningCustom
+func NewPruningOptions(strategy string, keepRecent, keepEvery int64) (PruningOptions, error) {
+	switch strategy {
+	case PruningDefault, "":
+		return DefaultPruningOptions(), nil
+	case PruningNothing:
+		return PruningOptions{}, nil
+	case PruningCustom:
+		opts := PruningOptions{KeepRecent: keepRecent, KeepEvery: keepEvery}
+		return opts, opts.Validate()
+	default:
+		return PruningOptions{}, fmt.Errorf("Pruning: unknown strategy '%v'", strategy)
+	}
+}
+
+// DefaultPruningOptions keeps the 2 most recent versions
+func DefaultPruningOptions() PruningOptions {
+	return PruningOptions{KeepRecent: 2}
+}
+
+// Validate the options
+func (po PruningOptions) Validate() error {
+	if po.KeepRecent < 0 {
+		return fmt.Errorf("Pruning: keep recent can't be negative")
+	}
+	if po.KeepEvery < 0 {
+		return fmt.Errorf("Pruning: keep every can't be negative")
+	}
+	if po.KeepRecent == 0 && po.KeepEvery > 0 {
+		return fmt.Errorf("Pruning: keep every requires keep recent > 0")
+	}
+	return nil
+}
+
+// toPrune returns the version that's no longer needed after committing
+// 'version', or 0 if nothing should be pruned
+func (po PruningOptions) toPrune(version int64) int64 {
+	if po.KeepRecent == 0 {
+		return 0
+	}
+	candidate := version - po.KeepRecent
+	if candidate <= 0 {
+		return 0
+	}
+	if po.KeepEvery > 0 && candidate%po.KeepEvery == 0 {
+		return 0
+	}
+	return candidate
+}
@@ -6,8 +6,15 @@ var _ TreeReader = (*Snapshot)(nil)
 
 // Snapshot provides a read-only view of committed data
 type Snapshot struct {
-	// TODO: Use Immutable tree
-	tree *iavl.MutableTree
+	tree readableTree
+}
+
+// readableTree is implemented by both the latest (mutable) tree and
+// the immutable trees of older versions
+type readableTree interface {
+	Get(key []byte) (int64, []byte)
+	GetWithProof(key []byte) ([]byte, *iavl.RangeProof, error)
+	IterateRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool
 }
 
 // NewSnapshot is created via store.Snapshot()
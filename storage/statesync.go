@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cosmos/iavl"
+	proto "github.com/golang/protobuf/proto"
+)
+
+const (
+	// SnapshotFormat is the current format of state sync snapshots
+	SnapshotFormat uint32 = 1
+	// SnapshotChunkSize is the max size, in bytes, of a snapshot chunk
+	SnapshotChunkSize = 4 << 20
+
+	snapshotInfoFile = "snapshot.pb"
+)
+
+var (
+	// ErrUnknownSnapshotFormat returned when a snapshot has a format we can't restore
+	ErrUnknownSnapshotFormat = errors.New("Snapshot: unknown format")
+	// ErrSnapshotNotFound returned when a snapshot or chunk doesn't exist on disk
+	ErrSnapshotNotFound = errors.New("Snapshot: not found")
+	// ErrInvalidChunk returned when a chunk doesn't match the hash in the snapshot metadata
+	ErrInvalidChunk = errors.New("Snapshot: invalid chunk")
+	// ErrNoRestore returned when applying a chunk without an active restore
+	ErrNoRestore = errors.New("Snapshot: no restore in progress")
+)
+
+// SnapshotManager creates, serves and restores state sync snapshots of the
+// state tree. Snapshots are stored on disk in 'dir', one directory per height
+type SnapshotManager struct {
+	store      *Store
+	dir        string
+	interval   int64
+	keepRecent int
+	chunkSize  int
+
+	mtx     sync.Mutex
+	running bool
+	restore *restorer
+}
+
+// NewSnapshotManager returns a manager for the given store. A snapshot is taken
+// every 'interval' heights (0 disables them) and only the 'keepRecent' most
+// recent are kept on disk (0 keeps all)
+func NewSnapshotManager(store *Store, dir string, interval int64, keepRecent int) *SnapshotManager {
+	return &SnapshotManager{
+		store:      store,
+		dir:        dir,
+		interval:   interval,
+		keepRecent: keepRecent,
+		chunkSize:  SnapshotChunkSize,
+	}
+}
+
+// ShouldSnapshot returns true if a snapshot should be taken at the given height
+func (sm *SnapshotManager) ShouldSnapshot(height int64) bool {
+	return sm.interval > 0 && height > 0 && height%sm.interval == 0
+}
+
+// Create exports the state tree at the given height into chunks on disk and
+// prunes old snapshots. Only one snapshot is created at a time.
+func (sm *SnapshotManager) Create(height int64) (*SnapshotInfo, error) {
+	export, err := sm.Begin(height)
+	if err != nil {
+		return nil, err
+	}
+	return export()
+}
+
+// Begin starts a snapshot at the given height and returns the func that
+// exports it, which can run in the background. The height is held in the
+// store until the export is done so pruning doesn't delete it. Begin must
+// be called from the goroutine that commits the store
+func (sm *SnapshotManager) Begin(height int64) (func() (*SnapshotInfo, error), error) {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	if sm.running {
+		return nil, fmt.Errorf("Snapshot: already creating a snapshot")
+	}
+	tree, err := sm.store.tree.GetImmutable(height)
+	if err != nil {
+		return nil, err
+	}
+	sm.running = true
+	sm.store.HoldVersion(height)
+
+	return func() (*SnapshotInfo, error) {
+		defer func() {
+			sm.store.ReleaseVersion(height)
+			sm.mtx.Lock()
+			sm.running = false
+			sm.mtx.Unlock()
+		}()
+		return sm.export(tree, height)
+	}, nil
+}
+
+// export the tree into chunks on disk
+func (sm *SnapshotManager) export(tree *iavl.ImmutableTree, height int64) (*SnapshotInfo, error) {
+	// Write to a temp dir first so a partial snapshot is never listed
+	final := sm.heightDir(height)
+	tmp := final + ".tmp"
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, 0)
+	err := exportChunks(tree, sm.chunkSize, func(chunk []byte) error {
+		hash := sha256.Sum256(chunk)
+		hashes = append(hashes, hash[:])
+		return ioutil.WriteFile(chunkFile(tmp, uint32(len(hashes)-1)), chunk, 0644)
+	})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	metadata, err := proto.Marshal(&SnapshotMetadata{ChunkHashes: hashes})
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	info := &SnapshotInfo{
+		Height:   height,
+		Format:   SnapshotFormat,
+		Chunks:   uint32(len(hashes)),
+		Hash:     snapshotHash(hashes),
+		Metadata: metadata,
+	}
+	bits, err := proto.Marshal(info)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, snapshotInfoFile), bits, 0644); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	os.RemoveAll(final)
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+	return info, sm.prune()
+}
+
+// List returns all snapshots on disk, most recent first
+func (sm *SnapshotManager) List() ([]*SnapshotInfo, error) {
+	heights, err := sm.heights()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*SnapshotInfo, 0, len(heights))
+	for i := len(heights) - 1; i >= 0; i-- {
+		bits, err := ioutil.ReadFile(filepath.Join(sm.heightDir(heights[i]), snapshotInfoFile))
+		if err != nil {
+			return nil, err
+		}
+		var info SnapshotInfo
+		if err := proto.Unmarshal(bits, &info); err != nil {
+			return nil, err
+		}
+		infos = append(infos, &info)
+	}
+	return infos, nil
+}
+
+// LoadChunk returns a chunk of the snapshot at the given height
+func (sm *SnapshotManager) LoadChunk(height int64, format uint32, chunk uint32) ([]byte, error) {
+	if format != SnapshotFormat {
+		return nil, ErrUnknownSnapshotFormat
+	}
+	bits, err := ioutil.ReadFile(chunkFile(sm.heightDir(height), chunk))
+	if os.IsNotExist(err) {
+		return nil, ErrSnapshotNotFound
+	}
+	return bits, err
+}
+
+// Restore starts restoring the given snapshot into the (empty) store.
+// Chunks are then applied, in order, with ApplyChunk
+func (sm *SnapshotManager) Restore(info SnapshotInfo) error {
+	if info.Format != SnapshotFormat {
+		return ErrUnknownSnapshotFormat
+	}
+	var metadata SnapshotMetadata
+	if err := proto.Unmarshal(info.Metadata, &metadata); err != nil {
+		return err
+	}
+	if info.Chunks == 0 || uint32(len(metadata.ChunkHashes)) != info.Chunks {
+		return fmt.Errorf("Snapshot: metadata has %v chunk hashes, expected %v", len(metadata.ChunkHashes), info.Chunks)
+	}
+	if !bytes.Equal(snapshotHash(metadata.ChunkHashes), info.Hash) {
+		return fmt.Errorf("Snapshot: metadata doesn't match the snapshot hash")
+	}
+
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	sm.abortRestore()
+	importer, err := sm.store.tree.Import(info.Height)
+	if err != nil {
+		return err
+	}
+	sm.restore = &restorer{
+		importer: importer,
+		height:   info.Height,
+		hashes:   metadata.ChunkHashes,
+	}
+	return nil
+}
+
+// ApplyChunk verifies and imports the next chunk of the active restore.
+// It returns true when the last chunk has been applied and the store
+// is at the restored height. ErrInvalidChunk means the chunk should be refetched.
+func (sm *SnapshotManager) ApplyChunk(index uint32, chunk []byte) (bool, error) {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	r := sm.restore
+	if r == nil {
+		return false, ErrNoRestore
+	}
+	if index != r.next {
+		return false, fmt.Errorf("Snapshot: expected chunk %v, got %v", r.next, index)
+	}
+	hash := sha256.Sum256(chunk)
+	if !bytes.Equal(hash[:], r.hashes[index]) {
+		return false, ErrInvalidChunk
+	}
+	if err := r.add(chunk); err != nil {
+		sm.abortRestore()
+		return false, err
+	}
+	r.next++
+	if int(r.next) < len(r.hashes) {
+		return false, nil
+	}
+
+	// All chunks applied
+	sm.restore = nil
+	return true, r.commit(sm.store)
+}
+
+// AbortRestore cancels an active restore, if any
+func (sm *SnapshotManager) AbortRestore() {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	sm.abortRestore()
+}
+
+func (sm *SnapshotManager) abortRestore() {
+	if sm.restore != nil {
+		sm.restore.importer.Close()
+		sm.restore = nil
+	}
+}
+
+// remove all but the 'keepRecent' most recent snapshots
+func (sm *SnapshotManager) prune() error {
+	if sm.keepRecent <= 0 {
+		return nil
+	}
+	heights, err := sm.heights()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(heights)-sm.keepRecent; i++ {
+		if err := os.RemoveAll(sm.heightDir(heights[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heights of the snapshots on disk in ascending order
+func (sm *SnapshotManager) heights() ([]int64, error) {
+	entries, err := ioutil.ReadDir(sm.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	heights := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// Skips temp dirs from in-progress snapshots
+		h, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+func (sm *SnapshotManager) heightDir(height int64) string {
+	return filepath.Join(sm.dir, strconv.FormatInt(height, 10))
+}
+
+func chunkFile(dir string, index uint32) string {
+	return filepath.Join(dir, strconv.FormatUint(uint64(index), 10))
+}
+
+// The snapshot hash is the hash of all the chunk hashes
+func snapshotHash(chunkHashes [][]byte) []byte {
+	hash := sha256.Sum256(bytes.Join(chunkHashes, nil))
+	return hash[:]
+}
+
+// exportChunks streams the tree as length-prefixed SnapshotNodes, calling 'fn'
+// for every 'chunkSize' bytes. Nodes may span chunks.
+func exportChunks(tree *iavl.ImmutableTree, chunkSize int, fn func(chunk []byte) error) error {
+	exporter := tree.Export()
+	defer exporter.Close()
+
+	var buf bytes.Buffer
+	chunks := 0
+	prefix := make([]byte, binary.MaxVarintLen64)
+	for {
+		node, err := exporter.Next()
+		if err == iavl.ExportDone {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		bits, err := proto.Marshal(&SnapshotNode{
+			Key:     node.Key,
+			Value:   node.Value,
+			Version: node.Version,
+			Height:  int32(node.Height),
+		})
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(prefix, uint64(len(bits)))
+		buf.Write(prefix[:n])
+		buf.Write(bits)
+
+		for buf.Len() >= chunkSize {
+			chunk := make([]byte, chunkSize)
+			buf.Read(chunk)
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunks++
+		}
+	}
+	// Always emit at least 1 chunk, even for an empty tree
+	if buf.Len() > 0 || chunks == 0 {
+		return fn(buf.Bytes())
+	}
+	return nil
+}
+
+// restorer holds the state of an in-progress restore
+type restorer struct {
+	importer *iavl.Importer
+	height   int64
+	hashes   [][]byte
+	next     uint32
+	// bytes of a node spanning chunks
+	buf []byte
+}
+
+// commit the imported tree to the store, at the restored height
+func (r *restorer) commit(st *Store) error {
+	if len(r.buf) != 0 {
+		r.importer.Close()
+		return fmt.Errorf("Snapshot: trailing data after the last node")
+	}
+	if err := r.importer.Commit(); err != nil {
+		return err
+	}
+	return st.saveCommitData(CommitData{Version: r.height, Hash: st.tree.Hash()})
+}
+
+// add imports all complete nodes in the chunk, buffering any partial node
+func (r *restorer) add(chunk []byte) error {
+	data := append(r.buf, chunk...)
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			// Need the next chunk
+			break
+		}
+		var node SnapshotNode
+		if err := proto.Unmarshal(data[n:n+int(size)], &node); err != nil {
+			return err
+		}
+		err := r.importer.Add(&iavl.ExportNode{
+			Key:     node.Key,
+			Value:   node.Value,
+			Version: node.Version,
+			Height:  int8(node.Height),
+		})
+		if err != nil {
+			return err
+		}
+		data = data[n+int(size):]
+	}
+	r.buf = append([]byte(nil), data...)
+	return nil
+}
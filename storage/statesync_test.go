@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "menta-snapshots")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Source store with a few versions of state
+	source := NewMemStore()
+	manager := NewSnapshotManager(source, dir, 2, 2)
+	// Force nodes to span chunks
+	manager.chunkSize = 64
+	for v := 0; v < 6; v++ {
+		cache := NewCache(source.Snapshot())
+		for i := 0; i < 20; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			cache.Put(key, []byte(fmt.Sprintf("value-%d-%d", v, i)))
+		}
+		cache.Remove([]byte(fmt.Sprintf("key-%d", v)))
+		info := source.Commit(cache.ToBatch())
+		if manager.ShouldSnapshot(info.Version) {
+			_, err := manager.Create(info.Version)
+			assert.Nil(err)
+		}
+	}
+
+	// Only the 2 most recent are kept
+	snapshots, err := manager.List()
+	assert.Nil(err)
+	assert.Equal(2, len(snapshots))
+	latest := snapshots[0]
+	assert.Equal(int64(6), latest.Height)
+	assert.Equal(int64(4), snapshots[1].Height)
+	assert.True(latest.Chunks > 1)
+
+	_, err = manager.LoadChunk(2, SnapshotFormat, 0)
+	assert.Equal(ErrSnapshotNotFound, err)
+
+	// Restore into an empty store
+	target := NewMemStore()
+	restorer := NewSnapshotManager(target, "", 0, 0)
+	assert.Nil(restorer.Restore(*latest))
+
+	// A bad chunk is rejected
+	_, err = restorer.ApplyChunk(0, []byte("bad chunk"))
+	assert.Equal(ErrInvalidChunk, err)
+
+	for i := uint32(0); i < latest.Chunks; i++ {
+		chunk, err := manager.LoadChunk(latest.Height, latest.Format, i)
+		assert.Nil(err)
+		done, err := restorer.ApplyChunk(i, chunk)
+		assert.Nil(err)
+		assert.Equal(i == latest.Chunks-1, done)
+	}
+
+	assert.Equal(source.CommitInfo.Version, target.CommitInfo.Version)
+	assert.Equal(source.CommitInfo.Hash, target.CommitInfo.Hash)
+
+	val, err := target.Snapshot().Get([]byte("key-1"))
+	assert.Nil(err)
+	assert.Equal([]byte("value-5-1"), val)
+	_, err = target.Snapshot().Get([]byte("key-5"))
+	assert.NotNil(err)
+
+	// And the restored store keeps committing from the snapshot height
+	cache := NewCache(target.Snapshot())
+	cache.Put([]byte("next"), []byte("block"))
+	info := target.Commit(cache.ToBatch())
+	assert.Equal(int64(7), info.Version)
+}
+
+func TestExportImportState(t *testing.T) {
+	assert := assert.New(t)
+	source := NewMemStore()
+	hashes := make(map[int64][]byte)
+	for v := 0; v < 4; v++ {
+		cache := NewCache(source.Snapshot())
+		for i := 0; i < 20; i++ {
+			cache.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d-%d", v, i)))
+		}
+		info := source.Commit(cache.ToBatch())
+		hashes[info.Version] = info.Hash
+	}
+
+	// An older version imports with the same hash
+	nodes, hash, err := source.ExportState(3)
+	assert.Nil(err)
+	assert.Equal(hashes[3], hash)
+
+	target := NewMemStore()
+	assert.Nil(target.ImportState(3, nodes))
+	assert.Equal(int64(3), target.CommitInfo.Version)
+	assert.Equal(hashes[3], target.CommitInfo.Hash)
+	val, err := target.Snapshot().Get([]byte("key-1"))
+	assert.Nil(err)
+	assert.Equal([]byte("value-2-1"), val)
+
+	// Only into an empty store
+	assert.NotNil(target.ImportState(3, nodes))
+	_, _, err = source.ExportState(10)
+	assert.NotNil(err)
+}
@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
 	fmt "fmt"
 	"sort"
+	"sync"
 
 	proto "github.com/golang/protobuf/proto"
 
@@ -21,6 +23,12 @@ var (
 	commitKey = []byte("/menta/commitinfo")
 	// ErrValueNotFound returned when the value for a key is nil
 	ErrValueNotFound = errors.New("Store get: nil value for given key")
+	// ErrVersionNotFound returned when a version was never committed or has been pruned
+	ErrVersionNotFound = errors.New("Store: version not found")
+	// ErrCorruptCommitInfo returned when the saved commit info can't be read
+	ErrCorruptCommitInfo = errors.New("Store: corrupt commit info")
+	// ErrVersionLoad returned when the tree can't load the last committed version
+	ErrVersionLoad = errors.New("Store: failed to load version")
 )
 
 var _ TreeWriter = (*Store)(nil)
@@ -30,31 +38,91 @@ type Store struct {
 	db         dbm.DB
 	tree       *iavl.MutableTree
 	CommitInfo CommitData
-	numHistory int64
+	pruning    PruningOptions
+
+	// Versions held by snapshot exports aren't pruned until released.
+	// Their pruning is deferred to a later commit
+	holdMtx sync.Mutex
+	held    map[int64]int
+	pending []int64
+}
+
+// Options for a Store
+type Options struct {
+	// Pruning decides which versions of state are kept
+	Pruning PruningOptions
+	// Backend of the database. Empty is goleveldb. Not used for in-memory stores
+	Backend dbm.BackendType
+}
+
+// DefaultOptions keeps the 2 most recent versions of state in goleveldb
+func DefaultOptions() Options {
+	return Options{
+		Pruning: DefaultPruningOptions(),
+		Backend: dbm.GoLevelDBBackend,
+	}
 }
 
-// NewStore creates a new instance.  If 'dbdir' == "", it'll
-// return an in-memory database
-func NewStore(dbdir string) *Store {
-	db, err := loadDb(dbdir)
+// Validate the options
+func (opts Options) Validate() error {
+	if err := opts.Pruning.Validate(); err != nil {
+		return err
+	}
+	return ValidateBackend(opts.Backend)
+}
+
+// NewStore creates a new instance with the default options.
+// If 'dbdir' == "", it'll return an in-memory database
+func NewStore(dbdir string) (*Store, error) {
+	return NewStoreWithOptions(dbdir, DefaultOptions())
+}
+
+// NewStoreWithOptions creates a new instance with the given options.
+// If 'dbdir' == "", it'll return an in-memory database
+func NewStoreWithOptions(dbdir string, opts Options) (*Store, error) {
+	if opts.Backend == "" {
+		opts.Backend = dbm.GoLevelDBBackend
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	db, err := loadDb(dbdir, opts.Backend)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	ci := loadCommitData(db)
+	ci, err := loadCommitData(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 	tree, err := iavl.NewMutableTree(db, cacheSize)
 	if err != nil {
-		panic(err)
+		db.Close()
+		return nil, err
+	}
+	if _, err := tree.LoadVersion(ci.Version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w %v: %v", ErrVersionLoad, ci.Version, err)
 	}
-
-	tree.LoadVersion(ci.Version)
 
 	return &Store{
 		db:         db,
 		tree:       tree,
 		CommitInfo: ci,
-		numHistory: 2, // Arbitrary for now...
+		pruning:    opts.Pruning,
+		held:       make(map[int64]int),
+	}, nil
+}
+
+// NewMemStore returns an in-memory store with the default options, for testing
+func NewMemStore() *Store {
+	st, err := NewStore("")
+	if err != nil {
+		// Can't happen with an in-memory db
+		panic(err)
 	}
+	return st
 }
 
 // Snapshot returns a read-only view of committed state
@@ -63,6 +131,80 @@ func (st *Store) Snapshot() TreeReader {
 	return NewSnapshot(st.tree)
 }
 
+// SnapshotAt returns a read-only view of state committed at the given
+// version. Only versions still retained by the store are available.
+// Version 0 is the latest committed state
+func (st *Store) SnapshotAt(version int64) (TreeReader, error) {
+	if version == 0 || version == st.CommitInfo.Version {
+		return st.Snapshot(), nil
+	}
+	if !st.tree.VersionExists(version) {
+		return nil, ErrVersionNotFound
+	}
+	tree, err := st.tree.GetImmutable(version)
+	if err != nil {
+		return nil, err
+	}
+	return Snapshot{tree: tree}, nil
+}
+
+// Versions returns the versions of state available for queries, in ascending order
+func (st *Store) Versions() []int64 {
+	available := st.tree.AvailableVersions()
+	versions := make([]int64, len(available))
+	for i, v := range available {
+		versions[i] = int64(v)
+	}
+	return versions
+}
+
+// SetInitialVersion sets the version of the first commit, for a chain that
+// starts at a height other than 1. It must be called before the first commit
+func (st *Store) SetInitialVersion(version int64) error {
+	if st.CommitInfo.Version > 0 {
+		return fmt.Errorf("can't set the initial version, the store is at version %v", st.CommitInfo.Version)
+	}
+	st.tree.SetInitialVersion(uint64(version))
+	return nil
+}
+
+// ExportState returns the tree at the given version, and its hash, as a
+// stream of nodes in the snapshot chunk format. The nodes keep the version
+// they were written at, so ImportState rebuilds a tree with the same hash
+func (st *Store) ExportState(version int64) ([]byte, []byte, error) {
+	tree, err := st.tree.GetImmutable(version)
+	if err != nil {
+		return nil, nil, err
+	}
+	var nodes bytes.Buffer
+	err = exportChunks(tree, SnapshotChunkSize, func(chunk []byte) error {
+		_, err := nodes.Write(chunk)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodes.Bytes(), tree.Hash(), nil
+}
+
+// ImportState loads the nodes from ExportState into the empty store and
+// commits them as the given version
+func (st *Store) ImportState(version int64, nodes []byte) error {
+	if st.CommitInfo.Version > 0 {
+		return fmt.Errorf("can't import state, the store is at version %v", st.CommitInfo.Version)
+	}
+	importer, err := st.tree.Import(version)
+	if err != nil {
+		return err
+	}
+	r := &restorer{importer: importer, height: version}
+	if err := r.add(nodes); err != nil {
+		importer.Close()
+		return err
+	}
+	return r.commit(st)
+}
+
 // LatestRootHash returns the current roothash of the committed tree
 func (st *Store) LatestRootHash() []byte {
 	return st.tree.WorkingHash()
@@ -93,25 +235,77 @@ func (st *Store) Commit(batch map[string]CacheOp) CommitData {
 
 	// Save the new version
 	hash, version, err := st.tree.SaveVersion()
+	if err != nil {
+		panic(err)
+	}
 
 	fmt.Printf("Version: %v  Hash: %v\n", version, hash)
 
-	// (from cosmos-sdk iavlstore) Release an old version of history
-	if st.numHistory > 0 && (st.numHistory < st.tree.Version()) {
-		toRelease := version - st.numHistory
-		st.tree.DeleteVersion(toRelease)
+	// Release an old version of history, if the pruning options allow it
+	if toRelease := st.pruning.toPrune(version); toRelease > 0 {
+		st.pending = append(st.pending, toRelease)
 	}
+	st.prune()
 
 	// save commit data to db
 	com := CommitData{Version: version, Hash: hash}
-	bits, err := proto.Marshal(&com)
-	if err != nil {
+	if err := st.saveCommitData(com); err != nil {
 		panic(err)
 	}
-	st.db.Set(commitKey, bits)
+	return com
+}
+
+// HoldVersion stops the version from being pruned until ReleaseVersion is
+// called, e.g. while it's exported in the background. It must be called
+// from the goroutine that commits
+func (st *Store) HoldVersion(version int64) {
+	st.holdMtx.Lock()
+	defer st.holdMtx.Unlock()
+	st.held[version]++
+}
 
+// ReleaseVersion releases a version held by HoldVersion. If it should have
+// been pruned in the meantime, it's pruned on the next commit
+func (st *Store) ReleaseVersion(version int64) {
+	st.holdMtx.Lock()
+	defer st.holdMtx.Unlock()
+	if st.held[version] <= 1 {
+		delete(st.held, version)
+		return
+	}
+	st.held[version]--
+}
+
+// prune deletes the pending versions that aren't held
+func (st *Store) prune() {
+	st.holdMtx.Lock()
+	defer st.holdMtx.Unlock()
+	kept := st.pending[:0]
+	for _, version := range st.pending {
+		if st.held[version] > 0 {
+			kept = append(kept, version)
+			continue
+		}
+		if st.tree.VersionExists(version) {
+			if err := st.tree.DeleteVersion(version); err != nil {
+				panic(err)
+			}
+		}
+	}
+	st.pending = kept
+}
+
+// saveCommitData to the db and update the current CommitInfo
+func (st *Store) saveCommitData(com CommitData) error {
+	bits, err := proto.Marshal(&com)
+	if err != nil {
+		return err
+	}
+	if err := st.db.Set(commitKey, bits); err != nil {
+		return err
+	}
 	st.CommitInfo = com
-	return com
+	return nil
 }
 
 // Close the DB
@@ -120,22 +314,28 @@ func (st *Store) Close() {
 }
 
 // LoadCommitData from the db
-func loadCommitData(db dbm.DB) CommitData {
-	commitBytes, _ := db.Get(commitKey)
+func loadCommitData(db dbm.DB) (CommitData, error) {
 	var ci CommitData
+	commitBytes, err := db.Get(commitKey)
+	if err != nil {
+		return ci, err
+	}
 	if commitBytes != nil {
-		err := proto.Unmarshal(commitBytes, &ci)
-		if err != nil {
-			panic(err)
+		if err := proto.Unmarshal(commitBytes, &ci); err != nil {
+			return ci, fmt.Errorf("%w: %v", ErrCorruptCommitInfo, err)
 		}
 	}
-	return ci
+	return ci, nil
 }
 
 // load the db
-func loadDb(dbdir string) (dbm.DB, error) {
+func loadDb(dbdir string, backend dbm.BackendType) (dbm.DB, error) {
 	if dbdir == "" {
 		return dbm.NewMemDB(), nil
 	}
-	return dbm.NewDB(StateDbName, dbm.GoLevelDBBackend, dbdir)
+	db, err := dbm.NewDB(StateDbName, backend, dbdir)
+	if err != nil {
+		return nil, fmt.Errorf("Store: can't open the %v db. Non-default backends need a build tag, e.g. -tags %v: %w", backend, backend, err)
+	}
+	return db, nil
 }
@@ -1,11 +1,16 @@
 package storage
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
+	proto "github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	dbm "github.com/tendermint/tm-db"
 )
 
 // Tests Store and Cache
@@ -15,7 +20,8 @@ func TestStoreBasics(t *testing.T) {
 		os.RemoveAll("mstate.db")
 	}()
 
-	st := NewStore(".")
+	st, err := NewStore(".")
+	assert.Nil(err)
 	dcache := NewCache(st.Snapshot())
 	// Setter/getter
 	dcache.Put([]byte("name"), []byte("dave"))
@@ -30,7 +36,8 @@ func TestStoreBasics(t *testing.T) {
 	st.Close()
 
 	// Check the store from the previous commit
-	st = NewStore(".")
+	st, err = NewStore(".")
+	assert.Nil(err)
 	snapshot := st.Snapshot()
 	dcache = NewCache(snapshot)
 	val, err = snapshot.Get([]byte("name"))
@@ -108,7 +115,8 @@ func TestStoreIter(t *testing.T) {
 	}
 	sort.Strings(keys)
 
-	st := NewStore(".")
+	st, err := NewStore(".")
+	assert.Nil(err)
 	cache := NewCache(st.Snapshot())
 	for _, r := range records {
 		cache.Put([]byte(r.key), []byte(r.value))
@@ -136,3 +144,201 @@ func TestStoreIter(t *testing.T) {
 	assert.Equal(9, len(allgs))
 
 }
+
+func TestCacheBranch(t *testing.T) {
+	assert := assert.New(t)
+	st := NewMemStore()
+	cache := NewCache(st.Snapshot())
+	cache.Put([]byte("a"), []byte("1"))
+	cache.Put([]byte("b"), []byte("2"))
+	st.Commit(cache.ToBatch())
+
+	cache = NewCache(st.Snapshot())
+	cache.Put([]byte("c"), []byte("3"))
+
+	// Reads fall through to the parent and the tree
+	branch := cache.Branch()
+	val, err := branch.Get([]byte("c"))
+	assert.Nil(err)
+	assert.Equal([]byte("3"), val)
+	val, err = branch.Get([]byte("a"))
+	assert.Nil(err)
+	assert.Equal([]byte("1"), val)
+
+	// Discarded branch leaves the parent unchanged
+	branch.Put([]byte("a"), []byte("changed"))
+	branch.Remove([]byte("b"))
+	_, err = branch.Get([]byte("b"))
+	assert.NotNil(err)
+	val, _ = cache.Get([]byte("a"))
+	assert.Equal([]byte("1"), val)
+	assert.True(cache.Has([]byte("b")))
+
+	// Written branch updates the parent
+	branch = cache.Branch()
+	branch.Put([]byte("a"), []byte("changed"))
+	branch.Remove([]byte("b"))
+	branch.Remove([]byte("c"))
+	branch.Write()
+	val, _ = cache.Get([]byte("a"))
+	assert.Equal([]byte("changed"), val)
+	assert.False(cache.Has([]byte("b")))
+	assert.False(cache.Has([]byte("c")))
+
+	st.Commit(cache.ToBatch())
+	snapshot := st.Snapshot()
+	val, _ = snapshot.Get([]byte("a"))
+	assert.Equal([]byte("changed"), val)
+	_, err = snapshot.Get([]byte("b"))
+	assert.NotNil(err)
+	_, err = snapshot.Get([]byte("c"))
+	assert.NotNil(err)
+}
+
+func TestPruning(t *testing.T) {
+	assert := assert.New(t)
+
+	commit := func(opts PruningOptions, n int) *Store {
+		st, err := NewStoreWithOptions("", Options{Pruning: opts})
+		assert.Nil(err)
+		for i := 0; i < n; i++ {
+			cache := NewCache(st.Snapshot())
+			cache.Put([]byte("height"), []byte{byte(i)})
+			st.Commit(cache.ToBatch())
+		}
+		return st
+	}
+
+	st := commit(DefaultPruningOptions(), 5)
+	assert.Equal([]int64{4, 5}, st.Versions())
+
+	st = commit(PruningOptions{}, 5)
+	assert.Equal([]int64{1, 2, 3, 4, 5}, st.Versions())
+
+	st = commit(PruningOptions{KeepRecent: 2, KeepEvery: 5}, 12)
+	assert.Equal([]int64{5, 10, 11, 12}, st.Versions())
+
+	// Historical state
+	snapshot, err := st.SnapshotAt(5)
+	assert.Nil(err)
+	val, err := snapshot.Get([]byte("height"))
+	assert.Nil(err)
+	assert.Equal([]byte{4}, val)
+	_, err = st.SnapshotAt(6)
+	assert.Equal(ErrVersionNotFound, err)
+
+	_, err = NewPruningOptions("custom", 0, 10)
+	assert.NotNil(err)
+	_, err = NewPruningOptions("sometimes", 0, 0)
+	assert.NotNil(err)
+}
+
+func TestCacheIterate(t *testing.T) {
+	assert := assert.New(t)
+	st := NewMemStore()
+	cache := NewCache(st.Snapshot())
+	for _, k := range []string{"a", "b", "c", "d"} {
+		cache.Put([]byte(k), []byte(k))
+	}
+	st.Commit(cache.ToBatch())
+
+	collect := func(c Cache, start, end []byte, ascending bool) []string {
+		kvs := []string{}
+		c.IterateKeyRange(start, end, ascending, func(key []byte, value []byte) bool {
+			kvs = append(kvs, string(key)+"="+string(value))
+			return false
+		})
+		return kvs
+	}
+
+	cache = NewCache(st.Snapshot())
+	cache.Put([]byte("bb"), []byte("new"))
+	cache.Put([]byte("c"), []byte("changed"))
+	cache.Remove([]byte("d"))
+	cache.Put([]byte("e"), []byte("new"))
+	// Cached read, not a change
+	cache.Get([]byte("a"))
+
+	assert.Equal([]string{"a=a", "b=b", "bb=new", "c=changed", "e=new"}, collect(cache, nil, nil, true))
+	assert.Equal([]string{"e=new", "c=changed", "bb=new", "b=b", "a=a"}, collect(cache, nil, nil, false))
+	assert.Equal([]string{"b=b", "bb=new", "c=changed"}, collect(cache, []byte("b"), []byte("d"), true))
+
+	// A branch sees its parent's changes and its own
+	branch := cache.Branch()
+	branch.Remove([]byte("a"))
+	branch.Remove([]byte("bb"))
+	branch.Put([]byte("d"), []byte("back"))
+	assert.Equal([]string{"b=b", "c=changed", "d=back", "e=new"}, collect(branch, nil, nil, true))
+	assert.Equal([]string{"a=a", "b=b", "bb=new", "c=changed", "e=new"}, collect(cache, nil, nil, true))
+
+	// Stop early
+	count := 0
+	stopped := branch.IterateKeyRange(nil, nil, false, func(key []byte, value []byte) bool {
+		count++
+		return count == 2
+	})
+	assert.True(stopped)
+	assert.Equal(2, count)
+}
+
+func TestMigrateDB(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "menta-migrate")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+
+	st, err := NewStore(src)
+	assert.Nil(err)
+	cache := NewCache(st.Snapshot())
+	cache.Put([]byte("name"), []byte("dave"))
+	info := st.Commit(cache.ToBatch())
+	st.Close()
+
+	count, err := MigrateDB(src, dbm.GoLevelDBBackend, dst, dbm.GoLevelDBBackend)
+	assert.Nil(err)
+	assert.True(count > 0)
+
+	// The copy loads at the same version
+	st, err = NewStoreWithOptions(dst, Options{Backend: dbm.GoLevelDBBackend})
+	assert.Nil(err)
+	assert.Equal(info, st.CommitInfo)
+	val, err := st.Snapshot().Get([]byte("name"))
+	assert.Nil(err)
+	assert.Equal([]byte("dave"), val)
+	st.Close()
+
+	// Won't overwrite
+	_, err = MigrateDB(src, dbm.GoLevelDBBackend, dst, dbm.GoLevelDBBackend)
+	assert.NotNil(err)
+
+	assert.NotNil(ValidateBackend("nope"))
+	// Known to tm-db but not compiled in
+	assert.NotNil(ValidateBackend(dbm.RocksDBBackend))
+	_, err = NewStoreWithOptions(dst, Options{Backend: "nope"})
+	assert.NotNil(err)
+}
+
+func TestStoreLoadErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "menta-store")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	db, err := loadDb(dir, dbm.GoLevelDBBackend)
+	assert.Nil(err)
+	assert.Nil(db.Set(commitKey, []byte("not commit info")))
+	db.Close()
+	_, err = NewStore(dir)
+	assert.True(errors.Is(err, ErrCorruptCommitInfo))
+
+	// Commit info for a version that was never saved
+	db, err = loadDb(dir, dbm.GoLevelDBBackend)
+	assert.Nil(err)
+	bits, err := proto.Marshal(&CommitData{Version: 10})
+	assert.Nil(err)
+	assert.Nil(db.Set(commitKey, bits))
+	db.Close()
+	_, err = NewStore(dir)
+	assert.True(errors.Is(err, ErrVersionLoad))
+}
@@ -28,6 +28,8 @@ type Cache interface {
 	Put(key, value []byte)
 	// Delete a key/value pair
 	Remove(key []byte)
+	// IterateKeyRange over [start, end), including pending writes. 'fn' returns true to stop
+	IterateKeyRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool
 	// ToBatch returns the cache storage
 	ToBatch() map[string]CacheOp
 }
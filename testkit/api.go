@@ -26,8 +26,13 @@ type TestKit struct {
 //           when the test finishes
 // service: is you application service to test
 func NewTestKit(homedir string, service sdk.Service) TestKit {
-	menta.InitTendermint(homedir)
-	app := menta.NewApp("testkit", homedir)
+	if err := menta.InitTendermint(homedir); err != nil {
+		panic(err)
+	}
+	app, err := menta.NewApp("testkit", menta.WithHomeDir(homedir))
+	if err != nil {
+		panic(err)
+	}
 	app.AddService(service)
 	c, err := rpcclient.New(rpcAddr, "/websocket")
 	if err != nil {
@@ -44,7 +49,9 @@ func NewTestKit(homedir string, service sdk.Service) TestKit {
 // Launch start the Tendermint node and waits for 2 seconds to ensure the node is running
 func (tk TestKit) Launch() {
 	go func() {
-		tk.app.Run()
+		if err := tk.app.Run(); err != nil {
+			panic(err)
+		}
 	}()
 	// Wait to make sure all is running
 	time.Sleep(2 * time.Second)
@@ -2,19 +2,24 @@ package testkit
 
 import (
 	mcrypto "github.com/davebryson/menta/crypto"
+	"github.com/davebryson/menta/services/accounts"
 	sdk "github.com/davebryson/menta/types"
 	"github.com/gogo/protobuf/proto"
 )
 
 // Wallet provides a way to generate and sign transactions
 type Wallet struct {
-	secretKey mcrypto.PrivateKeyEd25519
+	secretKey mcrypto.PrivKey
+	// next nonce to use
+	nonce    uint64
+	gasLimit uint64
 }
 
 // RandomWallet creates a new Wallet
 func RandomWallet() Wallet {
 	return Wallet{
 		secretKey: mcrypto.GeneratePrivateKey(),
+		gasLimit:  sdk.DefaultGasLimit,
 	}
 }
 
@@ -23,21 +28,52 @@ func RandomWallet() Wallet {
 func WalletFromSeed(seed string) Wallet {
 	return Wallet{
 		secretKey: mcrypto.PrivateKeyFromSecret([]byte(seed)),
+		gasLimit:  sdk.DefaultGasLimit,
 	}
 
 }
 
-// CreateTx generates and signs a transaction return it as encoded bytes
-func (wallet Wallet) CreateTx(serviceName string, msgid uint32, message proto.Message) ([]byte, error) {
+// WalletFromKey creates a wallet that signs with the given key, which can
+// be any of the key types in the crypto package
+func WalletFromKey(sk mcrypto.PrivKey) Wallet {
+	return Wallet{
+		secretKey: sk,
+		gasLimit:  sdk.DefaultGasLimit,
+	}
+}
+
+// CreateTx generates and signs a transaction return it as encoded bytes.
+// Each call uses the next nonce
+func (wallet *Wallet) CreateTx(serviceName string, msgid uint32, message proto.Message) ([]byte, error) {
 	encoded, err := proto.Marshal(message)
 	if err != nil {
 		return nil, err
 	}
-	t := &sdk.SignedTransaction{Service: serviceName, Msgid: msgid, Msg: encoded}
-	t.Sign(wallet.secretKey)
+	t := &sdk.SignedTransaction{
+		Service:  serviceName,
+		Msgid:    msgid,
+		Msg:      encoded,
+		Nonce:    accounts.EncodeNonce(wallet.nonce),
+		GasLimit: wallet.gasLimit,
+	}
+	if err := t.Sign(wallet.secretKey); err != nil {
+		return nil, err
+	}
+	wallet.nonce++
 	return sdk.EncodeTx(t)
 }
 
+// SetNonce sets the nonce used for the next tx. Use this to sync the
+// wallet with the nonce stored by the accounts service
+func (wallet *Wallet) SetNonce(nonce uint64) {
+	wallet.nonce = nonce
+}
+
+// SetGasLimit sets the gas limit for txs. Defaults to sdk.DefaultGasLimit
+func (wallet *Wallet) SetGasLimit(limit uint64) {
+	wallet.gasLimit = limit
+}
+
 // PubKey returns the publickey for the wallet as bytes
 func (wallet Wallet) PubKey() []byte {
 	return wallet.secretKey.PubKey().Bytes()
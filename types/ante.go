@@ -0,0 +1,33 @@
+package types
+
+// AnteHandler processes a tx in both CheckTx (isCheck is true) and DeliverTx.
+// A non-OK Result rejects the tx
+type AnteHandler func(ctx Context, tx *SignedTransaction, store Cache, isCheck bool) Result
+
+// Middleware wraps the processing of every tx. It can reject the tx by
+// returning a Result without calling next, or pass an updated ctx on to
+// next. Use it for checks that apply to every tx, such as fees, permissions
+// or rate limits.
+//
+// Writes to store are kept even if the tx fails, so check the tx before
+// writing. Store access isn't charged gas, use ctx.GasMeter() to charge for
+// any work done.
+//
+// The service runs on a branch of the store passed to next, and the
+// branch is written to it with Put and Remove if the service succeeds. So
+// middleware can wrap the store to restrict or watch what the service does
+// with state
+type Middleware func(ctx Context, tx *SignedTransaction, store Cache, isCheck bool, next AnteHandler) Result
+
+// ChainMiddleware returns a handler that runs the middleware in order, with
+// 'final' at the end of the chain
+func ChainMiddleware(final AnteHandler, middleware ...Middleware) AnteHandler {
+	handler := final
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mw, next := middleware[i], handler
+		handler = func(ctx Context, tx *SignedTransaction, store Cache, isCheck bool) Result {
+			return mw(ctx, tx, store, isCheck, next)
+		}
+	}
+	return handler
+}
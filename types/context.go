@@ -0,0 +1,103 @@
+package types
+
+import (
+	"context"
+	"time"
+
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
+// Context is passed to services with the state of the tx or block being
+// processed. A new Context is created for every tx and block hook.
+//
+// The block info comes from the header of the block being processed. In
+// CheckTx it's the last block, and in queries only the chain-id and the
+// height of the state being queried are set
+type Context struct {
+	base   context.Context
+	events *EventManager
+	gas    GasMeter
+	header tmproto.Header
+	txHash []byte
+}
+
+// NewContext returns a Context with an empty EventManager and an infinite GasMeter
+func NewContext() Context {
+	return Context{
+		base:   context.Background(),
+		events: NewEventManager(),
+		gas:    NewInfiniteGasMeter(),
+	}
+}
+
+// EventManager to emit events from a service
+func (ctx Context) EventManager() *EventManager {
+	return ctx.events
+}
+
+// GasMeter of the tx being processed
+func (ctx Context) GasMeter() GasMeter {
+	return ctx.gas
+}
+
+// WithGasMeter returns a copy of the Context with the given GasMeter
+func (ctx Context) WithGasMeter(meter GasMeter) Context {
+	ctx.gas = meter
+	return ctx
+}
+
+// BlockHeader of the block being processed
+func (ctx Context) BlockHeader() tmproto.Header {
+	return ctx.header
+}
+
+// WithBlockHeader returns a copy of the Context with the given block header
+func (ctx Context) WithBlockHeader(header tmproto.Header) Context {
+	ctx.header = header
+	return ctx
+}
+
+// BlockHeight of the block being processed
+func (ctx Context) BlockHeight() int64 {
+	return ctx.header.Height
+}
+
+// BlockTime of the block being processed, set by the proposer. Use it
+// rather than the local clock, which differs between nodes
+func (ctx Context) BlockTime() time.Time {
+	return ctx.header.Time
+}
+
+// ChainID from the genesis file
+func (ctx Context) ChainID() string {
+	return ctx.header.ChainID
+}
+
+// ProposerAddress of the validator that proposed the block
+func (ctx Context) ProposerAddress() []byte {
+	return ctx.header.ProposerAddress
+}
+
+// TxHash is the hash of the raw tx being processed. It's empty in block hooks
+func (ctx Context) TxHash() []byte {
+	return ctx.txHash
+}
+
+// WithTxHash returns a copy of the Context with the given tx hash
+func (ctx Context) WithTxHash(hash []byte) Context {
+	ctx.txHash = hash
+	return ctx
+}
+
+// Value returns the value set for key by WithValue, or nil
+func (ctx Context) Value(key interface{}) interface{} {
+	return ctx.base.Value(key)
+}
+
+// WithValue returns a copy of the Context that has value for key. Use it in
+// middleware to pass data on to the rest of the chain. As with context.Context,
+// keys should be an unexported type to avoid collisions
+func (ctx Context) WithValue(key, value interface{}) Context {
+	ctx.base = context.WithValue(ctx.base, key, value)
+	return ctx
+}
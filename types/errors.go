@@ -0,0 +1,126 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// RootCodespace is the codespace of menta's own error codes
+const RootCodespace = "menta"
+
+// Errors for menta's own codes
+var (
+	ErrHandlerNotFound = Register(RootCodespace, HandlerNotFound, "handler not found")
+	ErrBadTx           = Register(RootCodespace, BadTx, "bad tx")
+	ErrNotFound        = Register(RootCodespace, NotFound, "not found")
+	ErrBadQuery        = Register(RootCodespace, BadQuery, "bad query")
+	ErrUnauthorized    = Register(RootCodespace, Unauthorized, "unauthorized")
+	ErrOutOfGas        = Register(RootCodespace, OutOfGas, "out of gas")
+	ErrPanic           = Register(RootCodespace, Panic, "panic")
+)
+
+var registry = struct {
+	sync.RWMutex
+	errors map[string]map[uint32]*Error
+}{errors: make(map[string]map[uint32]*Error)}
+
+// Error is a registered error. The codespace, usually the service name,
+// and the code identify it in tx results so clients can tell errors apart.
+// Use Wrap to add context
+type Error struct {
+	codespace string
+	code      uint32
+	desc      string
+}
+
+// Register an error for the codespace and code. Services should register
+// their errors as package variables. Panics if the code is 0 or already
+// registered in the codespace
+func Register(codespace string, code uint32, description string) *Error {
+	if code == OK {
+		panic(fmt.Sprintf("error code 0 is OK, can't register '%v' in %v", description, codespace))
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	codes, ok := registry.errors[codespace]
+	if !ok {
+		codes = make(map[uint32]*Error)
+		registry.errors[codespace] = codes
+	}
+	if existing, ok := codes[code]; ok {
+		panic(fmt.Sprintf("error code %v is already registered in %v as '%v'", code, codespace, existing.desc))
+	}
+	err := &Error{codespace: codespace, code: code, desc: description}
+	codes[code] = err
+	return err
+}
+
+// RegisteredError returns the error registered for the codespace and code
+func RegisteredError(codespace string, code uint32) (*Error, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	err, ok := registry.errors[codespace][code]
+	return err, ok
+}
+
+func (e *Error) Error() string { return e.desc }
+
+// Codespace of the error
+func (e *Error) Codespace() string { return e.codespace }
+
+// Code of the error in its codespace
+func (e *Error) Code() uint32 { return e.code }
+
+// Is matches errors with the same codespace and code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.codespace == e.codespace && t.code == e.code
+}
+
+// Wrap the error with context. errors.Is still matches the registered error
+func (e *Error) Wrap(context string) error {
+	return fmt.Errorf("%s: %w", context, e)
+}
+
+// Wrapf wraps the error with formatted context
+func (e *Error) Wrapf(format string, args ...interface{}) error {
+	return e.Wrap(fmt.Sprintf(format, args...))
+}
+
+// Result for the error
+func (e *Error) Result() Result {
+	return ResultFromError(e)
+}
+
+// ResultFromError returns a failed Result with the codespace and code of the
+// registered error in err's chain. Other errors get the BadTx code
+func ResultFromError(err error) Result {
+	var registered *Error
+	if !errors.As(err, &registered) {
+		registered = ErrBadTx
+	}
+	return Result{
+		Codespace: registered.codespace,
+		Code:      registered.code,
+		Log:       err.Error(),
+	}
+}
+
+// ABCIError turns the codespace, code and log of an ABCI response back into
+// an error. It's nil for OK. A registered error is wrapped with the log, so
+// errors.Is matches it. Otherwise it's an unregistered Error with the log as
+// its description
+func ABCIError(codespace string, code uint32, log string) error {
+	if code == OK {
+		return nil
+	}
+	registered, ok := RegisteredError(codespace, code)
+	if !ok {
+		return &Error{codespace: codespace, code: code, desc: log}
+	}
+	if log == "" || log == registered.desc {
+		return registered
+	}
+	return registered.Wrap(log)
+}
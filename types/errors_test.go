@@ -0,0 +1,57 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	errMissing := Register("errtest", 1, "missing")
+	errOther := Register("errtest", 2, "other")
+
+	// Codes are unique in a codespace, and 0 is OK
+	assert.Panics(func() { Register("errtest", 1, "again") })
+	assert.Panics(func() { Register("errtest", OK, "ok") })
+	assert.NotPanics(func() { Register("errtest2", 1, "missing") })
+
+	found, ok := RegisteredError("errtest", 2)
+	assert.True(ok)
+	assert.Equal(errOther, found)
+	_, ok = RegisteredError("errtest", 3)
+	assert.False(ok)
+
+	// Wrapping keeps the codes
+	wrapped := fmt.Errorf("outer: %w", errMissing.Wrapf("key %v", "alice"))
+	assert.Equal("outer: key alice: missing", wrapped.Error())
+	assert.True(errors.Is(wrapped, errMissing))
+	assert.False(errors.Is(wrapped, errOther))
+
+	result := ResultFromError(wrapped)
+	assert.Equal("errtest", result.Codespace)
+	assert.Equal(uint32(1), result.Code)
+	assert.Equal(wrapped.Error(), result.Log)
+
+	// Unregistered errors are bad txs
+	result = ResultFromError(errors.New("boom"))
+	assert.Equal(RootCodespace, result.Codespace)
+	assert.Equal(BadTx, result.Code)
+
+	// Back from the response
+	assert.Nil(ABCIError("", OK, ""))
+	back := ABCIError(result.Codespace, result.Code, result.Log)
+	assert.True(errors.Is(back, ErrBadTx))
+	assert.Equal("boom: bad tx", back.Error())
+	back = ABCIError("errtest", 1, "missing")
+	assert.Equal(errMissing, back)
+	back = ABCIError("errtest", 9, "unknown")
+	assert.Equal("unknown", back.Error())
+	var unregistered *Error
+	assert.True(errors.As(back, &unregistered))
+	assert.Equal(uint32(9), unregistered.Code())
+	assert.False(errors.Is(back, errMissing))
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+const (
+	// EventTypeTx is the type of the event menta adds to every tx
+	EventTypeTx = "tx"
+	// AttributeKeyService is the name of the service the tx was sent to
+	AttributeKeyService = "service"
+	// AttributeKeySender is the hex encoded sender of the tx
+	AttributeKeySender = "sender"
+	// AttributeKeyMsgID is the msgid of the tx
+	AttributeKeyMsgID = "msgid"
+)
+
+// EventManager collects the events emitted by services while running a tx
+// or a block hook. The events are returned to Tendermint which indexes them
+// so clients can search and subscribe, for example: transfer.recipient='...'
+type EventManager struct {
+	events []abci.Event
+}
+
+// NewEventManager returns an empty event manager
+func NewEventManager() *EventManager {
+	return &EventManager{events: make([]abci.Event, 0)}
+}
+
+// EmitEvent adds an event
+func (em *EventManager) EmitEvent(event abci.Event) {
+	em.events = append(em.events, event)
+}
+
+// EmitEvents adds the events in order
+func (em *EventManager) EmitEvents(events ...abci.Event) {
+	em.events = append(em.events, events...)
+}
+
+// Events returns the events emitted so far
+func (em *EventManager) Events() []abci.Event {
+	return em.events
+}
+
+// NewEvent returns an event of the given type with the attributes
+func NewEvent(eventType string, attributes ...abci.EventAttribute) abci.Event {
+	return abci.Event{
+		Type:       eventType,
+		Attributes: attributes,
+	}
+}
+
+// NewAttribute returns an indexed event attribute
+func NewAttribute(key, value string) abci.EventAttribute {
+	return abci.EventAttribute{
+		Key:   []byte(key),
+		Value: []byte(value),
+		Index: true,
+	}
+}
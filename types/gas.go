@@ -0,0 +1,174 @@
+package types
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/davebryson/menta/storage"
+)
+
+// DefaultGasLimit is a reasonable gas limit for simple txs
+const DefaultGasLimit uint64 = 200000
+
+// ErrorOutOfGas is the value a GasMeter panics with when the limit is exceeded.
+// Menta recovers it and fails the tx with the OutOfGas code
+type ErrorOutOfGas struct {
+	Descriptor string
+}
+
+func (e ErrorOutOfGas) Error() string {
+	return fmt.Sprintf("out of gas: %v", e.Descriptor)
+}
+
+// GasInfo is the gas reported back to Tendermint for a tx
+type GasInfo struct {
+	GasWanted uint64
+	GasUsed   uint64
+}
+
+// GasMeter tracks the gas consumed by a tx or a block
+type GasMeter interface {
+	// GasConsumed so far
+	GasConsumed() uint64
+	// Limit of the meter
+	Limit() uint64
+	// ConsumeGas adds 'amount' to the gas consumed. Panics with ErrorOutOfGas
+	// if the limit is exceeded
+	ConsumeGas(amount uint64, descriptor string)
+	// IsOutOfGas returns true if consumed gas exceeds the limit
+	IsOutOfGas() bool
+}
+
+type basicGasMeter struct {
+	limit    uint64
+	consumed uint64
+}
+
+// NewGasMeter returns a meter with the given limit
+func NewGasMeter(limit uint64) GasMeter {
+	return &basicGasMeter{limit: limit}
+}
+
+func (g *basicGasMeter) GasConsumed() uint64 { return g.consumed }
+
+func (g *basicGasMeter) Limit() uint64 { return g.limit }
+
+func (g *basicGasMeter) IsOutOfGas() bool { return g.consumed > g.limit }
+
+func (g *basicGasMeter) ConsumeGas(amount uint64, descriptor string) {
+	if g.consumed > math.MaxUint64-amount {
+		g.consumed = math.MaxUint64
+		panic(ErrorOutOfGas{descriptor})
+	}
+	g.consumed += amount
+	if g.consumed > g.limit {
+		panic(ErrorOutOfGas{descriptor})
+	}
+}
+
+type infiniteGasMeter struct {
+	consumed uint64
+}
+
+// NewInfiniteGasMeter returns a meter that tracks gas but never runs out
+func NewInfiniteGasMeter() GasMeter {
+	return &infiniteGasMeter{}
+}
+
+func (g *infiniteGasMeter) GasConsumed() uint64 { return g.consumed }
+
+func (g *infiniteGasMeter) Limit() uint64 { return math.MaxUint64 }
+
+func (g *infiniteGasMeter) IsOutOfGas() bool { return false }
+
+func (g *infiniteGasMeter) ConsumeGas(amount uint64, descriptor string) {
+	if g.consumed > math.MaxUint64-amount {
+		g.consumed = math.MaxUint64
+		return
+	}
+	g.consumed += amount
+}
+
+// GasConfig is the gas charged for store access. It must be the same on
+// every node so it's set in code rather than the node config file
+type GasConfig struct {
+	HasCost          uint64
+	DeleteCost       uint64
+	ReadCostFlat     uint64
+	ReadCostPerByte  uint64
+	WriteCostFlat    uint64
+	WriteCostPerByte uint64
+	IterNextCostFlat uint64
+}
+
+// DefaultGasConfig returns the default costs (adapted from the Cosmos SDK)
+func DefaultGasConfig() GasConfig {
+	return GasConfig{
+		HasCost:          1000,
+		DeleteCost:       1000,
+		ReadCostFlat:     1000,
+		ReadCostPerByte:  3,
+		WriteCostFlat:    2000,
+		WriteCostPerByte: 30,
+		IterNextCostFlat: 30,
+	}
+}
+
+var _ Cache = (*GasCache)(nil)
+
+// GasCache wraps a Cache and charges gas for every access
+type GasCache struct {
+	parent Cache
+	meter  GasMeter
+	config GasConfig
+}
+
+// NewGasCache returns a cache that charges the meter for each operation on 'parent'
+func NewGasCache(parent Cache, meter GasMeter, config GasConfig) GasCache {
+	return GasCache{
+		parent: parent,
+		meter:  meter,
+		config: config,
+	}
+}
+
+// Get charges a flat fee plus the size of the value
+func (gc GasCache) Get(key []byte) ([]byte, error) {
+	gc.meter.ConsumeGas(gc.config.ReadCostFlat, "read flat")
+	value, err := gc.parent.Get(key)
+	gc.meter.ConsumeGas(gc.config.ReadCostPerByte*uint64(len(value)), "read per byte")
+	return value, err
+}
+
+// Has charges a flat fee
+func (gc GasCache) Has(key []byte) bool {
+	gc.meter.ConsumeGas(gc.config.HasCost, "has")
+	return gc.parent.Has(key)
+}
+
+// Put charges a flat fee plus the size of the key and value
+func (gc GasCache) Put(key, value []byte) {
+	gc.meter.ConsumeGas(gc.config.WriteCostFlat, "write flat")
+	gc.meter.ConsumeGas(gc.config.WriteCostPerByte*uint64(len(key)+len(value)), "write per byte")
+	gc.parent.Put(key, value)
+}
+
+// Remove charges a flat fee
+func (gc GasCache) Remove(key []byte) {
+	gc.meter.ConsumeGas(gc.config.DeleteCost, "delete")
+	gc.parent.Remove(key)
+}
+
+// IterateKeyRange charges a flat fee for every key plus the size of the key and value
+func (gc GasCache) IterateKeyRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	return gc.parent.IterateKeyRange(start, end, ascending, func(key []byte, value []byte) bool {
+		gc.meter.ConsumeGas(gc.config.IterNextCostFlat, "iterator next")
+		gc.meter.ConsumeGas(gc.config.ReadCostPerByte*uint64(len(key)+len(value)), "iterator value per byte")
+		return fn(key, value)
+	})
+}
+
+// ToBatch returns the batch of the parent cache
+func (gc GasCache) ToBatch() map[string]storage.CacheOp {
+	return gc.parent.ToBatch()
+}
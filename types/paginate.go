@@ -0,0 +1,69 @@
+package types
+
+// DefaultPageLimit is the page size used when PageRequest.Limit is 0
+const DefaultPageLimit = 100
+
+// RangeIterator is implemented by PrefixedKVStore and PrefixedSnapshot
+type RangeIterator interface {
+	IterateRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool
+}
+
+// PageRequest selects a page of keys in a query
+type PageRequest struct {
+	// Cursor is the first key of the page, from PageResponse.NextCursor.
+	// Empty starts at the first (or last, if Reverse) key. A cursor outside
+	// the prefix is clamped to it
+	Cursor []byte
+	// Limit is the max number of keys in the page. 0 uses DefaultPageLimit
+	Limit int
+	// Reverse returns keys in descending order
+	Reverse bool
+}
+
+// PageResponse is returned with a page
+type PageResponse struct {
+	// NextCursor is the cursor for the next page. nil on the last page
+	NextCursor []byte
+}
+
+// Paginate calls 'fn' for each key/value, with the given prefix, in the page.
+// Keys are relative to the store and include 'prefix'. For example, a query
+// handler listing a page of accounts:
+//
+//	store := sdk.NewPrefixedSnapshot(ServiceName, snapshot)
+//	page, err := sdk.Paginate(store, []byte("accounts/"), req, func(key, value []byte) error {
+//		accounts = append(accounts, value)
+//		return nil
+//	})
+func Paginate(store RangeIterator, prefix []byte, req PageRequest, fn func(key []byte, value []byte) error) (PageResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+
+	start, end := prefix, PrefixEnd(prefix)
+	if len(req.Cursor) > 0 {
+		if req.Reverse {
+			// end is exclusive, so include the cursor
+			end = append(append([]byte(nil), req.Cursor...), 0x00)
+		} else {
+			start = req.Cursor
+		}
+		// The cursor comes from the client. Don't let it leave the prefix
+		start, end = clampRange(prefix, start, end)
+	}
+
+	var res PageResponse
+	var err error
+	count := 0
+	store.IterateRange(start, end, !req.Reverse, func(key []byte, value []byte) bool {
+		if count == limit {
+			res.NextCursor = append([]byte(nil), key...)
+			return true
+		}
+		count++
+		err = fn(key, value)
+		return err != nil
+	})
+	return res, err
+}
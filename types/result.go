@@ -1,5 +1,9 @@
 package types
 
+import (
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
 // Helper for returning results from check/deliver calls
 
 const (
@@ -13,21 +17,34 @@ const (
 	NotFound
 	// BadQuery - in store query
 	BadQuery
+	// Unauthorized - the sender isn't allowed to send the tx
+	Unauthorized
+	// OutOfGas - the tx used more than its gas limit, or the block's
+	OutOfGas
+	// Panic - the service panicked. Menta recovers and fails the tx
+	Panic
 )
 
 // Result is it returned from a menta app TxHandler
 // By default 'Code' will be zero which mean 'Ok' to tendermint
 type Result struct {
-	Code uint32 // Any non-zero code is an error
-	Data []byte
-	Log  string
+	// Codespace of the code, see Register
+	Codespace string
+	Code      uint32 // Any non-zero code is an error
+	Data      []byte
+	Log       string
+	// Events returned to Tendermint with the tx. Menta sets them from the
+	// Context EventManager
+	Events []abci.Event
 }
 
-// ResultError is returned on an error with a non-zero code
+// ResultError is returned on an error with one of menta's non-zero codes.
+// Services should return their own errors with ResultFromError
 func ResultError(code uint32, log string) Result {
 	return Result{
-		Code: code,
-		Log:  log,
+		Codespace: RootCodespace,
+		Code:      code,
+		Log:       log,
 	}
 }
 
@@ -0,0 +1,102 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// MsgHandler processes a decoded tx message. 'msg' is a new instance of the
+// prototype registered for the msgid
+type MsgHandler func(ctx Context, sender []byte, msg proto.Message, store Cache) Result
+
+// QueryHandler processes a decoded query. 'req' is a new instance of the
+// prototype registered for the query
+type QueryHandler func(ctx Context, req proto.Message, store Snapshot) Result
+
+// Routable is an optional interface for services that register handlers with
+// a Router. Menta uses the Router to decode and dispatch the service's txs and
+// queries instead of calling Execute
+type Routable interface {
+	Routes() *Router
+}
+
+type msgRoute struct {
+	prototype proto.Message
+	handler   MsgHandler
+}
+
+type queryRoute struct {
+	prototype proto.Message
+	handler   QueryHandler
+}
+
+// Router dispatches tx messages by msgid, and queries by name, to typed handlers
+type Router struct {
+	msgs    map[uint32]msgRoute
+	queries map[string]queryRoute
+}
+
+// NewRouter returns an empty router
+func NewRouter() *Router {
+	return &Router{
+		msgs:    make(map[uint32]msgRoute),
+		queries: make(map[string]queryRoute),
+	}
+}
+
+// Handle registers the handler for the msgid. The tx msg is decoded into a new
+// instance of 'prototype'. Panics if the msgid is already registered
+func (r *Router) Handle(msgid uint32, prototype proto.Message, handler MsgHandler) *Router {
+	if _, ok := r.msgs[msgid]; ok {
+		panic(fmt.Sprintf("Router: msgid %v is already registered", msgid))
+	}
+	r.msgs[msgid] = msgRoute{prototype, handler}
+	return r
+}
+
+// HandleQuery registers the handler for the named query. The query data is
+// decoded into a new instance of 'prototype'. Panics if the name is already registered
+func (r *Router) HandleQuery(name string, prototype proto.Message, handler QueryHandler) *Router {
+	if _, ok := r.queries[name]; ok {
+		panic(fmt.Sprintf("Router: query '%v' is already registered", name))
+	}
+	r.queries[name] = queryRoute{prototype, handler}
+	return r
+}
+
+// Execute decodes the message and calls the handler for the msgid
+func (r *Router) Execute(ctx Context, sender []byte, msgid uint32, message []byte, store Cache) Result {
+	route, ok := r.msgs[msgid]
+	if !ok {
+		return ErrorNoHandler()
+	}
+	msg, err := decodeInto(route.prototype, message)
+	if err != nil {
+		return ErrorBadTx()
+	}
+	return route.handler(ctx, sender, msg, store)
+}
+
+// Query decodes the query data and calls the handler for the named query
+func (r *Router) Query(ctx Context, name string, data []byte, store Snapshot) Result {
+	route, ok := r.queries[name]
+	if !ok {
+		return ErrorNoHandler()
+	}
+	req, err := decodeInto(route.prototype, data)
+	if err != nil {
+		return ResultError(BadQuery, err.Error())
+	}
+	return route.handler(ctx, req, store)
+}
+
+// decodeInto unmarshals bits into a new instance of the prototype's type
+func decodeInto(prototype proto.Message, bits []byte) (proto.Message, error) {
+	msg := reflect.New(reflect.TypeOf(prototype).Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(bits, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -1,16 +1,57 @@
 package types
 
+import (
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
 // Service is the primary interface to implement for application services.
 // A given MentaApp may have 1 or more of these.
 type Service interface {
 	// Name is the unique name of the service. Used to register your service in Menta
 	Name() string
 	// Init is called once, on the very first run of the application.
-	// Use this to load genesis data for your service
-	Initialize(data []byte, store Cache)
+	// Use this to load genesis data for your service. 'data' is the service's
+	// section of the genesis app state, keyed by Name, or nil if it has none.
+	// The ctx has the chain-id, initial height and genesis time. An error
+	// stops the chain from starting
+	Initialize(ctx Context, data []byte, store Cache) error
 	// Execute is the primary business logic of your service. This is the blockchain
-	// state transistion function
-	Execute(sender []byte, msgid uint32, message []byte, store Cache) Result
+	// state transistion function. Events emitted with the ctx EventManager are
+	// returned with the tx if it succeeds
+	Execute(ctx Context, sender []byte, msgid uint32, message []byte, store Cache) Result
 	// Query provides read access to storage.
-	Query(key []byte, store Snapshot) Result
+	Query(ctx Context, key []byte, store Snapshot) Result
+}
+
+// Exporter is an optional interface for services that export their state,
+// for restarting a chain from a new genesis file. Export returns the
+// service's section of the genesis app state, which must load back with
+// Initialize to the same state
+type Exporter interface {
+	Export(ctx Context, store Snapshot) ([]byte, error)
+}
+
+// Validator is an optional interface a Service can implement to validate
+// transactions in CheckTx, before they enter the mempool. Check runs against
+// the check state, which is discarded on every commit. Writes made by Check
+// are visible to later checks in the same block, not to DeliverTx.
+type Validator interface {
+	// Check returns a non-zero Result.Code to reject the tx
+	Check(ctx Context, sender []byte, msgid uint32, message []byte, store Cache) Result
+}
+
+// BeginBlocker is an optional interface for services that run logic at the
+// start of every block, before any transactions. Hooks are called in the
+// order services were registered. Events emitted with the ctx EventManager
+// are returned in ResponseBeginBlock.
+type BeginBlocker interface {
+	BeginBlock(ctx Context, header tmproto.Header, store Cache)
+}
+
+// EndBlocker is an optional interface for services that run logic at the
+// end of every block, after all transactions. Hooks are called in the
+// order services were registered. Events emitted with the ctx EventManager
+// are returned in ResponseEndBlock.
+type EndBlocker interface {
+	EndBlock(ctx Context, height int64, store Cache)
 }
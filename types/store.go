@@ -1,6 +1,7 @@
 package types
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/davebryson/menta/storage"
@@ -63,6 +64,19 @@ func (ps PrefixedKVStore) Remove(key []byte) {
 	ps.store.Remove(ps.key(key))
 }
 
+// IterateRange over the keys in [start, end) under the prefix. Keys are given,
+// and passed to 'fn', without the prefix. A nil end iterates to the last key
+// of the prefix. 'fn' returns true to stop
+func (ps PrefixedKVStore) IterateRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	s, e := prefixRange(ps.prefix, start, end)
+	return ps.store.IterateKeyRange(s, e, ascending, stripPrefix(ps.prefix, fn))
+}
+
+// IteratePrefix over all the keys that start with 'prefix' under the store prefix
+func (ps PrefixedKVStore) IteratePrefix(prefix []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	return ps.IterateRange(prefix, PrefixEnd(prefix), ascending, fn)
+}
+
 type PrefixedSnapshot struct {
 	prefix []byte
 	store  Snapshot
@@ -78,3 +92,56 @@ func NewPrefixedSnapshot(prefix string, snapshot Snapshot) PrefixedSnapshot {
 func (ps PrefixedSnapshot) Get(key []byte) ([]byte, error) {
 	return ps.store.Get(PrefixedKey(ps.prefix, key))
 }
+
+// IterateRange over the keys in [start, end) under the prefix. Keys are given,
+// and passed to 'fn', without the prefix. A nil end iterates to the last key
+// of the prefix. 'fn' returns true to stop
+func (ps PrefixedSnapshot) IterateRange(start, end []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	s, e := prefixRange(ps.prefix, start, end)
+	return ps.store.IterateKeyRange(s, e, ascending, stripPrefix(ps.prefix, fn))
+}
+
+// IteratePrefix over all the keys that start with 'prefix' under the store prefix
+func (ps PrefixedSnapshot) IteratePrefix(prefix []byte, ascending bool, fn func(key []byte, value []byte) bool) bool {
+	return ps.IterateRange(prefix, PrefixEnd(prefix), ascending, fn)
+}
+
+// PrefixEnd returns the first key after all the keys that start with 'prefix',
+// or nil if there isn't one (the prefix is empty or all 0xff)
+func PrefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// prefixRange returns the full range of [start, end) under the prefix
+func prefixRange(prefix, start, end []byte) ([]byte, []byte) {
+	s := PrefixedKey(prefix, start)
+	if end == nil {
+		return s, PrefixEnd(prefix)
+	}
+	return s, PrefixedKey(prefix, end)
+}
+
+// clampRange limits [start, end) to the keys that start with 'prefix'
+func clampRange(prefix, start, end []byte) ([]byte, []byte) {
+	if bytes.Compare(start, prefix) < 0 {
+		start = prefix
+	}
+	if last := PrefixEnd(prefix); last != nil && (end == nil || bytes.Compare(end, last) > 0) {
+		end = last
+	}
+	return start, end
+}
+
+func stripPrefix(prefix []byte, fn func(key []byte, value []byte) bool) func(key []byte, value []byte) bool {
+	return func(key []byte, value []byte) bool {
+		return fn(key[len(prefix):], value)
+	}
+}
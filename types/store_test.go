@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/davebryson/menta/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixedIterate(t *testing.T) {
+	assert := assert.New(t)
+	st := storage.NewMemStore()
+	cache := storage.NewCache(st.Snapshot())
+	one := NewPrefixedKVStore("one", cache)
+	two := NewPrefixedKVStore("two", cache)
+	// Keys just past the end of the "one" prefix
+	onf := NewPrefixedKVStore("onf", cache)
+	for _, k := range []string{"a/1", "a/2", "b/1", "b/2", "c"} {
+		one.Put([]byte(k), []byte(k))
+		two.Put([]byte(k), []byte(k))
+		onf.Put([]byte(k), []byte("onf"))
+	}
+	st.Commit(cache.ToBatch())
+
+	collect := func(iter func(fn func(key []byte, value []byte) bool) bool) []string {
+		keys := []string{}
+		iter(func(key []byte, value []byte) bool {
+			keys = append(keys, string(key))
+			return false
+		})
+		return keys
+	}
+
+	snap := NewPrefixedSnapshot("one", st.Snapshot())
+	all := collect(func(fn func(key []byte, value []byte) bool) bool {
+		return snap.IterateRange(nil, nil, true, fn)
+	})
+	assert.Equal([]string{"a/1", "a/2", "b/1", "b/2", "c"}, all)
+
+	desc := collect(func(fn func(key []byte, value []byte) bool) bool {
+		return snap.IteratePrefix([]byte("b/"), false, fn)
+	})
+	assert.Equal([]string{"b/2", "b/1"}, desc)
+
+	// Same on the KVStore
+	kv := NewPrefixedKVStore("two", storage.NewCache(st.Snapshot()))
+	rng := collect(func(fn func(key []byte, value []byte) bool) bool {
+		return kv.IterateRange([]byte("a/2"), []byte("c"), true, fn)
+	})
+	assert.Equal([]string{"a/2", "b/1", "b/2"}, rng)
+}
+
+func TestPaginate(t *testing.T) {
+	assert := assert.New(t)
+	st := storage.NewMemStore()
+	cache := storage.NewCache(st.Snapshot())
+	store := NewPrefixedKVStore("svc", cache)
+	for i := 0; i < 5; i++ {
+		store.Put([]byte(fmt.Sprintf("acct/%v", i)), []byte{byte(i)})
+	}
+	store.Put([]byte("other"), []byte("x"))
+	st.Commit(cache.ToBatch())
+	snap := NewPrefixedSnapshot("svc", st.Snapshot())
+
+	pages := func(req PageRequest) [][]string {
+		result := [][]string{}
+		for {
+			page := []string{}
+			res, err := Paginate(snap, []byte("acct/"), req, func(key []byte, value []byte) error {
+				page = append(page, string(key))
+				return nil
+			})
+			assert.Nil(err)
+			result = append(result, page)
+			if res.NextCursor == nil {
+				return result
+			}
+			req.Cursor = res.NextCursor
+		}
+	}
+
+	assert.Equal([][]string{{"acct/0", "acct/1"}, {"acct/2", "acct/3"}, {"acct/4"}}, pages(PageRequest{Limit: 2}))
+	assert.Equal([][]string{{"acct/4", "acct/3", "acct/2"}, {"acct/1", "acct/0"}}, pages(PageRequest{Limit: 3, Reverse: true}))
+	assert.Equal([][]string{{"acct/0", "acct/1", "acct/2", "acct/3", "acct/4"}}, pages(PageRequest{}))
+
+	// Cursors outside the prefix are clamped to it
+	assert.Equal([][]string{{"acct/0", "acct/1", "acct/2", "acct/3", "acct/4"}}, pages(PageRequest{Cursor: []byte("a")}))
+	assert.Equal([][]string{{}}, pages(PageRequest{Cursor: []byte("a"), Reverse: true}))
+	assert.Equal([][]string{{}}, pages(PageRequest{Cursor: []byte("other")}))
+	assert.Equal([][]string{{"acct/4", "acct/3", "acct/2", "acct/1", "acct/0"}}, pages(PageRequest{Cursor: []byte("other"), Reverse: true}))
+}
@@ -24,11 +24,13 @@ func EncodeTx(tx *SignedTransaction) ([]byte, error) {
 // Hash the tx for signing
 func (tx *SignedTransaction) hashMsg() ([]byte, error) {
 	bits, err := proto.Marshal(&SignedTransaction{
-		Sender:  tx.Sender,
-		Service: tx.Service,
-		Msg:     tx.Msg,
-		Msgid:   tx.Msgid,
-		Nonce:   tx.Nonce,
+		Sender:   tx.Sender,
+		Service:  tx.Service,
+		Msg:      tx.Msg,
+		Msgid:    tx.Msgid,
+		Nonce:    tx.Nonce,
+		GasLimit: tx.GasLimit,
+		KeyType:  tx.KeyType,
 	})
 	if err != nil {
 		return nil, err
@@ -37,27 +39,60 @@ func (tx *SignedTransaction) hashMsg() ([]byte, error) {
 	return hash[:], nil
 }
 
-// Sign a transaction
-func (tx *SignedTransaction) Sign(sk crypto.PrivateKeyEd25519) error {
+// Sign a transaction. Sets the sender and key type from the key
+func (tx *SignedTransaction) Sign(sk crypto.PrivKey) error {
 	tx.Sender = sk.PubKey().Bytes()
+	tx.KeyType = uint32(sk.Type())
 	msgHash, err := tx.hashMsg()
 	if err != nil {
 		return err
 	}
-	tx.Sig = sk.Sign(msgHash)
-	return nil
+	tx.Sig, err = sk.Sign(msgHash)
+	return err
 }
 
-// Verify a Tx against based on the sender's public key
+// Verify a Tx against based on the sender's public key, using the
+// signature scheme of the tx key type
 func (tx *SignedTransaction) Verify() bool {
 	msg, err := tx.hashMsg()
 	if err != nil {
 		return false
 	}
 	// Get the public key from the sender field
-	pk, err := crypto.PublicKeyFromBytes(tx.Sender)
+	pk, err := crypto.PubKeyFromBytes(crypto.KeyType(tx.KeyType), tx.Sender)
 	if err != nil {
 		return false
 	}
 	return pk.Verify(msg, tx.Sig)
 }
+
+// VerifyBatch verifies the signatures of all the txs at once and returns
+// the result for each tx. Only ed25519 signatures are batched, the others
+// are verified one at a time
+func VerifyBatch(txs []*SignedTransaction) []bool {
+	valid := make([]bool, len(txs))
+	batch := crypto.NewBatchVerifier()
+	// index in txs of each signature in the batch
+	indexes := make([]int, 0, len(txs))
+	for i, tx := range txs {
+		if crypto.KeyType(tx.KeyType) != crypto.KeyTypeEd25519 {
+			valid[i] = tx.Verify()
+			continue
+		}
+		msg, err := tx.hashMsg()
+		if err != nil {
+			continue
+		}
+		pk, err := crypto.PubKeyFromBytes(crypto.KeyTypeEd25519, tx.Sender)
+		if err != nil {
+			continue
+		}
+		batch.Add(pk.(crypto.PublicKeyEd25519), msg, tx.Sig)
+		indexes = append(indexes, i)
+	}
+	_, results := batch.Verify()
+	for i, ok := range results {
+		valid[indexes[i]] = ok
+	}
+	return valid
+}
@@ -37,3 +37,30 @@ func TestTx(t *testing.T) {
 	bob2, err := crypto.PublicKeyFromHex(bobPubHex)
 	assert.Equal(bob.PubKey().Bytes(), bob2.Bytes())
 }
+
+func TestTxKeyTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, sk := range []crypto.PrivKey{crypto.GeneratePrivateKey(), crypto.GenerateSecp256k1Key()} {
+		tx := &SignedTransaction{Service: "one", Nonce: []byte("random"), Msg: []byte("hello")}
+		assert.Nil(tx.Sign(sk))
+		assert.Equal(uint32(sk.Type()), tx.KeyType)
+
+		txbits, err := EncodeTx(tx)
+		assert.Nil(err)
+		txBack, err := DecodeTx(txbits)
+		assert.Nil(err)
+		assert.True(txBack.Verify())
+
+		// The key type is signed, and the sender must match it
+		txBack.KeyType ^= 1
+		assert.False(txBack.Verify())
+	}
+
+	// Batches mix key types
+	good, bad := &SignedTransaction{Service: "one"}, &SignedTransaction{Service: "two"}
+	assert.Nil(good.Sign(crypto.GenerateSecp256k1Key()))
+	assert.Nil(bad.Sign(crypto.GeneratePrivateKey()))
+	bad.Sig[0] ^= 1
+	assert.Equal([]bool{true, false}, VerifyBatch([]*SignedTransaction{good, bad}))
+}
@@ -25,12 +25,15 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 // 'msg' is a []byte of application specific content,
 // the application is reponsible for encoding/decoding it.
 type SignedTransaction struct {
-	Service              string   `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
-	Sender               []byte   `protobuf:"bytes,2,opt,name=sender,proto3" json:"sender,omitempty"`
-	Msgid                uint32   `protobuf:"varint,3,opt,name=msgid,proto3" json:"msgid,omitempty"`
-	Msg                  []byte   `protobuf:"bytes,4,opt,name=msg,proto3" json:"msg,omitempty"`
-	Nonce                []byte   `protobuf:"bytes,5,opt,name=nonce,proto3" json:"nonce,omitempty"`
-	Sig                  []byte   `protobuf:"bytes,6,opt,name=sig,proto3" json:"sig,omitempty"`
+	Service  string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Sender   []byte `protobuf:"bytes,2,opt,name=sender,proto3" json:"sender,omitempty"`
+	Msgid    uint32 `protobuf:"varint,3,opt,name=msgid,proto3" json:"msgid,omitempty"`
+	Msg      []byte `protobuf:"bytes,4,opt,name=msg,proto3" json:"msg,omitempty"`
+	Nonce    []byte `protobuf:"bytes,5,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Sig      []byte `protobuf:"bytes,6,opt,name=sig,proto3" json:"sig,omitempty"`
+	GasLimit uint64 `protobuf:"varint,7,opt,name=gas_limit,json=gasLimit,proto3" json:"gas_limit,omitempty"`
+	// crypto.KeyType of the sender. 0 is ed25519
+	KeyType              uint32   `protobuf:"varint,8,opt,name=key_type,json=keyType,proto3" json:"key_type,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -103,6 +106,20 @@ func (m *SignedTransaction) GetSig() []byte {
 	return nil
 }
 
+func (m *SignedTransaction) GetGasLimit() uint64 {
+	if m != nil {
+		return m.GasLimit
+	}
+	return 0
+}
+
+func (m *SignedTransaction) GetKeyType() uint32 {
+	if m != nil {
+		return m.KeyType
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*SignedTransaction)(nil), "types.SignedTransaction")
 }
@@ -110,15 +127,18 @@ func init() {
 func init() { proto.RegisterFile("types.proto", fileDescriptor_d938547f84707355) }
 
 var fileDescriptor_d938547f84707355 = []byte{
-	// 160 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x34, 0xce, 0x41, 0xaa, 0xc2, 0x30,
-	0x10, 0xc6, 0x71, 0xf2, 0xfa, 0x5a, 0x71, 0x54, 0xd0, 0x20, 0x32, 0xcb, 0xe2, 0xaa, 0x2b, 0x37,
-	0xde, 0xa4, 0x7a, 0x81, 0xda, 0x0e, 0x61, 0x16, 0x9d, 0x94, 0x4c, 0x10, 0x3c, 0x88, 0xf7, 0x95,
-	0x24, 0xba, 0x9b, 0xdf, 0xf0, 0x5f, 0x7c, 0xb0, 0x89, 0xaf, 0x85, 0xf4, 0xb2, 0x04, 0x1f, 0xbd,
-	0xad, 0x33, 0xce, 0x6f, 0x03, 0x87, 0x1b, 0x3b, 0xa1, 0xe9, 0x1e, 0x06, 0xd1, 0x61, 0x8c, 0xec,
-	0xc5, 0x22, 0xac, 0x94, 0xc2, 0x93, 0x47, 0x42, 0xd3, 0x9a, 0x6e, 0xdd, 0xff, 0x68, 0x4f, 0xd0,
-	0x28, 0xc9, 0x44, 0x01, 0xff, 0x5a, 0xd3, 0x6d, 0xfb, 0xaf, 0xec, 0x11, 0xea, 0x59, 0x1d, 0x4f,
-	0x58, 0xb5, 0xa6, 0xdb, 0xf5, 0x05, 0x76, 0x0f, 0xd5, 0xac, 0x0e, 0xff, 0x73, 0x9a, 0xce, 0xd4,
-	0x89, 0x97, 0x91, 0xb0, 0xce, 0xbf, 0x82, 0xd4, 0x29, 0x3b, 0x6c, 0x4a, 0xa7, 0xec, 0x1e, 0x4d,
-	0x5e, 0x79, 0xfd, 0x04, 0x00, 0x00, 0xff, 0xff, 0x21, 0x55, 0x15, 0x74, 0xb4, 0x00, 0x00, 0x00,
+	// 197 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x34, 0xcf, 0xcf, 0x4a, 0xc4, 0x30,
+	0x10, 0xc7, 0x71, 0xe2, 0x6e, 0xff, 0xec, 0xa8, 0xa0, 0x41, 0x64, 0xc4, 0x4b, 0xf1, 0xd4, 0x93,
+	0x17, 0x5f, 0xc3, 0x53, 0xdc, 0xfb, 0x12, 0xdb, 0x21, 0x0c, 0xb5, 0x49, 0xc9, 0x04, 0x21, 0x0f,
+	0xe9, 0x3b, 0x49, 0x52, 0xbd, 0xe5, 0x13, 0xbe, 0x30, 0xfc, 0xe0, 0x3a, 0xe5, 0x8d, 0xe4, 0x75,
+	0x8b, 0x21, 0x05, 0xdd, 0x54, 0xbc, 0xfc, 0x28, 0xb8, 0xff, 0x60, 0xe7, 0x69, 0x3e, 0x47, 0xeb,
+	0xc5, 0x4e, 0x89, 0x83, 0xd7, 0x08, 0x9d, 0x50, 0xfc, 0xe6, 0x89, 0x50, 0x0d, 0x6a, 0x3c, 0x99,
+	0x7f, 0xea, 0x47, 0x68, 0x85, 0xfc, 0x4c, 0x11, 0xaf, 0x06, 0x35, 0xde, 0x98, 0x3f, 0xe9, 0x07,
+	0x68, 0x56, 0x71, 0x3c, 0xe3, 0x61, 0x50, 0xe3, 0xad, 0xd9, 0xa1, 0xef, 0xe0, 0xb0, 0x8a, 0xc3,
+	0x63, 0x4d, 0xcb, 0xb3, 0x74, 0x3e, 0xf8, 0x89, 0xb0, 0xa9, 0x7f, 0x3b, 0x4a, 0x27, 0xec, 0xb0,
+	0xdd, 0x3b, 0x61, 0xa7, 0x9f, 0xe1, 0xe4, 0xac, 0x5c, 0xbe, 0x78, 0xe5, 0x84, 0xdd, 0xa0, 0xc6,
+	0xa3, 0xe9, 0x9d, 0x95, 0xf7, 0x62, 0xfd, 0x04, 0xfd, 0x42, 0xf9, 0x52, 0x16, 0x60, 0x5f, 0xef,
+	0x75, 0x0b, 0xe5, 0x73, 0xde, 0xe8, 0xb3, 0xad, 0xeb, 0xde, 0x7e, 0x07, 0x00, 0x34, 0x73, 0x9a,
+	0x77, 0xec, 0x00, 0x00, 0x00,
 }